@@ -0,0 +1,152 @@
+package btree
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+)
+
+//=============================================================================
+//= Variables and Constants
+//=============================================================================
+
+// Binary format identifiers.
+const (
+	binaryMagic   = "BTRE"
+	binaryVersion = 1
+)
+
+// Largest order accepted by UnmarshalBinary. Nodes are allocated at full
+// capacity, so a corrupt order must not be trusted to size them.
+const maxSerializedOrder = 1 << 16
+
+//=============================================================================
+//= Types
+//=============================================================================
+
+// An ItemCodec converts Items to and from bytes.
+//
+// A codec must be set with SetCodec before a BTree can be serialized with
+// MarshalBinary or UnmarshalBinary.
+type ItemCodec interface {
+	MarshalItem(item Item) ([]byte, error)
+	UnmarshalItem(data []byte) (Item, error)
+}
+
+//=============================================================================
+//= Methods
+//=============================================================================
+
+// SetCodec sets the codec used to serialize the BTree's items.
+func (b *BTree) SetCodec(c ItemCodec) {
+	b.codec = c
+}
+
+// MarshalBinary implements the encoding.BinaryMarshaler interface.
+//
+// The encoding consists of a magic number and format version, the tree's
+// order, and its items in ascending order, followed by a CRC-32 checksum of
+// everything before it. Each item is encoded with the tree's codec.
+func (b *BTree) MarshalBinary() ([]byte, error) {
+	if b.codec == nil {
+		return nil, errors.New("BTree has no item codec")
+	}
+	iter := b.NewIterator()
+	return marshalBinary(b.order, b.codec, func() (Item, bool) {
+		if !iter.HasNext() {
+			return nil, false
+		}
+		item, _ := iter.Next()
+		return item, true
+	})
+}
+
+// UnmarshalBinary implements the encoding.BinaryUnmarshaler interface.
+//
+// It replaces the contents and order of the BTree with those decoded from
+// data, which must have been produced by MarshalBinary. Items are decoded
+// with the tree's codec.
+func (b *BTree) UnmarshalBinary(data []byte) error {
+	if b.codec == nil {
+		return errors.New("BTree has no item codec")
+	}
+	if len(data) < len(binaryMagic)+1+crc32.Size || !bytes.HasPrefix(data, []byte(binaryMagic)) {
+		return errors.New("data is not a serialized BTree")
+	}
+	sumPos := len(data) - crc32.Size
+	if crc32.ChecksumIEEE(data[:sumPos]) != binary.BigEndian.Uint32(data[sumPos:]) {
+		return errors.New("serialized BTree checksum mismatch")
+	}
+	if v := data[len(binaryMagic)]; v != binaryVersion {
+		return fmt.Errorf("unsupported serialized BTree version %d", v)
+	}
+
+	r := bytes.NewReader(data[len(binaryMagic)+1 : sumPos])
+	order, err := binary.ReadUvarint(r)
+	if err != nil {
+		return errors.New("serialized BTree has invalid order")
+	} else if order < 3 {
+		return ErrInvalidOrder
+	} else if order > maxSerializedOrder {
+		return fmt.Errorf("serialized BTree order %d exceeds maximum of %d", order, maxSerializedOrder)
+	}
+	count, err := binary.ReadUvarint(r)
+	if err != nil {
+		return errors.New("serialized BTree has invalid item count")
+	}
+
+	bl := newBulkloader(int(order))
+	for i := uint64(0); i < count; i++ {
+		size, err := binary.ReadUvarint(r)
+		if err != nil || size > uint64(r.Len()) {
+			return fmt.Errorf("serialized BTree item %d is truncated", i)
+		}
+		itemData := make([]byte, size)
+		r.Read(itemData)
+		item, err := b.codec.UnmarshalItem(itemData)
+		if err != nil {
+			return err
+		}
+		if err := bl.addChecked(item); err != nil {
+			return err
+		}
+	}
+	if r.Len() != 0 {
+		return errors.New("serialized BTree has trailing data")
+	}
+
+	b.order = bl.tree.order
+	b.root = bl.tree.root
+	b.adopt(bl.tree)
+	return nil
+}
+
+//=============================================================================
+//= Functions
+//=============================================================================
+
+// marshalBinary encodes a tree of the given order holding the ascending
+// items returned by next, in the format described by MarshalBinary.
+func marshalBinary(order int, codec ItemCodec, next func() (Item, bool)) ([]byte, error) {
+	var body []byte
+	count := 0
+	for item, ok := next(); ok; item, ok = next() {
+		data, err := codec.MarshalItem(item)
+		if err != nil {
+			return nil, err
+		}
+		body = binary.AppendUvarint(body, uint64(len(data)))
+		body = append(body, data...)
+		count++
+	}
+
+	buf := make([]byte, 0, len(binaryMagic)+1+2*binary.MaxVarintLen64+len(body)+crc32.Size)
+	buf = append(buf, binaryMagic...)
+	buf = append(buf, binaryVersion)
+	buf = binary.AppendUvarint(buf, uint64(order))
+	buf = binary.AppendUvarint(buf, uint64(count))
+	buf = append(buf, body...)
+	return binary.BigEndian.AppendUint32(buf, crc32.ChecksumIEEE(buf)), nil
+}
@@ -0,0 +1,154 @@
+package btree
+
+import (
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"testing"
+)
+
+func TestMarshalBinary(t *testing.T) {
+	cases := []struct {
+		items []Item
+		order int
+	}{
+		// Should round-trip empty trees
+		{items: uniqueInputsN(0), order: 3},
+		// Should round-trip trees of various orders
+		{items: uniqueInputsN(1), order: 3},
+		{items: uniqueInputsN(1000), order: 3},
+		{items: uniqueInputsN(1000), order: 17},
+	}
+
+	for _, c := range cases {
+		b := Bulkload(c.order, c.items)
+		b.SetCodec(testItemCodec{})
+		data, err := b.MarshalBinary()
+		if err != nil {
+			t.Fatalf("MarshalBinary should not have failed: %v", err)
+		}
+
+		var decoded BTree
+		decoded.SetCodec(testItemCodec{})
+		if err := decoded.UnmarshalBinary(data); err != nil {
+			t.Fatalf("UnmarshalBinary should not have failed: %v", err)
+		}
+		if decoded.order != c.order {
+			t.Errorf("Decoded tree should have order %d. Got: %d", c.order, decoded.order)
+		}
+		checkLoaded(t, &decoded, nil, c.items, false)
+
+		// Should be usable after decoding into a zero-value tree
+		extra := &testItem{key: len(c.items)}
+		decoded.Insert(extra)
+		decoded.Delete(extra)
+		for _, item := range c.items[:len(c.items)/2] {
+			decoded.Delete(item)
+		}
+		_, stop := decoded.Watch(nil, nil, 0)
+		stop()
+		checkLoaded(t, &decoded, nil, c.items[len(c.items)/2:], false)
+	}
+}
+
+func TestUnmarshalBinaryErrors(t *testing.T) {
+	b := Bulkload(5, uniqueInputsN(100))
+	b.SetCodec(testItemCodec{})
+	valid, _ := b.MarshalBinary()
+
+	corrupt := append([]byte(nil), valid...)
+	corrupt[len(corrupt)/2] ^= 0xff
+	badVersion := append([]byte(nil), valid...)
+	badVersion[4] = 99
+	badVersion = resum(badVersion)
+	unsorted := append([]byte(nil), valid...)
+	unsorted[len(binaryMagic)+4] ^= 0x7f // First byte of the first item's key.
+	unsorted = resum(unsorted)
+	none := func() (Item, bool) { return nil, false }
+	smallOrder, _ := marshalBinary(2, testItemCodec{}, none)
+	hugeOrder, _ := marshalBinary(1<<40, testItemCodec{}, none)
+
+	cases := []struct {
+		data  []byte
+		codec ItemCodec
+	}{
+		// Should require a codec
+		{data: valid, codec: nil},
+		// Should reject data which is not a serialized tree
+		{data: []byte("not a tree"), codec: testItemCodec{}},
+		{data: valid[:3], codec: testItemCodec{}},
+		// Should reject corrupted or truncated data
+		{data: corrupt, codec: testItemCodec{}},
+		{data: valid[:len(valid)-1], codec: testItemCodec{}},
+		// Should reject unknown versions
+		{data: badVersion, codec: testItemCodec{}},
+		// Should reject unsorted items
+		{data: unsorted, codec: testItemCodec{}},
+		// Should reject orders too small or too large to allocate
+		{data: smallOrder, codec: testItemCodec{}},
+		{data: hugeOrder, codec: testItemCodec{}},
+		// Should report codec errors
+		{data: valid, codec: failingCodec{}},
+	}
+
+	for i, c := range cases {
+		var decoded BTree
+		decoded.SetCodec(c.codec)
+		if err := decoded.UnmarshalBinary(c.data); err == nil {
+			t.Errorf("Case %d: UnmarshalBinary should have failed", i)
+		}
+	}
+
+	var decoded BTree
+	decoded.SetCodec(testItemCodec{})
+	if err := decoded.UnmarshalBinary(smallOrder); !errors.Is(err, ErrInvalidOrder) {
+		t.Errorf("UnmarshalBinary should have returned ErrInvalidOrder. Got: %v", err)
+	}
+
+	b.SetCodec(failingCodec{})
+	if _, err := b.MarshalBinary(); err == nil {
+		t.Errorf("MarshalBinary should have reported codec error")
+	}
+}
+
+//=============================================================================
+//= Helpers
+//=============================================================================
+
+// A testItemCodec encodes testItems as pairs of big-endian int64s.
+type testItemCodec struct{}
+
+func (testItemCodec) MarshalItem(item Item) ([]byte, error) {
+	ti := item.(*testItem)
+	data := make([]byte, 16)
+	binary.BigEndian.PutUint64(data, uint64(ti.key))
+	binary.BigEndian.PutUint64(data[8:], uint64(ti.val))
+	return data, nil
+}
+
+func (testItemCodec) UnmarshalItem(data []byte) (Item, error) {
+	if len(data) != 16 {
+		return nil, errors.New("testItem must be 16 bytes")
+	}
+	return &testItem{
+		key: int(int64(binary.BigEndian.Uint64(data))),
+		val: int(int64(binary.BigEndian.Uint64(data[8:]))),
+	}, nil
+}
+
+// A failingCodec is an ItemCodec which always fails.
+type failingCodec struct{}
+
+func (failingCodec) MarshalItem(item Item) ([]byte, error) {
+	return nil, errors.New("marshal failed")
+}
+
+func (failingCodec) UnmarshalItem(data []byte) (Item, error) {
+	return nil, errors.New("unmarshal failed")
+}
+
+// resum recomputes the checksum of serialized tree data.
+func resum(data []byte) []byte {
+	sumPos := len(data) - 4
+	return binary.BigEndian.AppendUint32(data[:sumPos], crc32.ChecksumIEEE(data[:sumPos]))
+}
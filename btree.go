@@ -2,16 +2,35 @@
 package btree
 
 import (
+	"bufio"
 	"errors"
 	"fmt"
+	"io"
 	"math"
+	"os"
 	"sort"
+	"strings"
+	"unsafe"
 )
 
 //=============================================================================
 //= Variables and Constants
 //=============================================================================
 
+// Errors returned by the trees in this package, which can be checked for
+// with errors.Is.
+var (
+	// ErrNotFound reports that an item is not in a tree.
+	ErrNotFound = errors.New("item not found")
+	// ErrIteratorExhausted reports that an iterator has no next item.
+	ErrIteratorExhausted = errors.New("Iterator does not have next")
+	// ErrOrderMismatch reports that trees which must have the same order
+	// do not.
+	ErrOrderMismatch = errors.New("BTrees must have same order")
+	// ErrInvalidOrder reports an order too small for a B-Tree.
+	ErrInvalidOrder = errors.New("BTree order must be at least 3")
+)
+
 // Direction values for Iterator
 const (
 	forward = 1
@@ -24,8 +43,14 @@ const (
 
 // A BTree represents a B-Tree.
 type BTree struct {
-	order int   // Maximum number of children each node can have.
-	root  *node // Root node of BTree.
+	order int       // Maximum number of children each node can have.
+	root  *node     // Root node of BTree.
+	codec ItemCodec // Codec for binary serialization of items.
+
+	factory ItemFactory // Constructor for items decoded from JSON.
+
+	observers *observers // Subscribers to changes.
+	freelist  *FreeList  // Source of new nodes, and destination of freed ones.
 }
 
 // An Item is an element which can be compared to another Item.
@@ -33,6 +58,18 @@ type Item interface {
 	Less(other Item) bool
 }
 
+// A Comparer is an Item which can also be compared three-way.
+//
+// Compare returns a negative number if the item is less than other, zero if
+// they are equal, and a positive number if it is greater. It must be
+// consistent with Less. When the item being inserted, deleted or searched
+// for is a Comparer, each step of the search finds equality with a single
+// call to Compare, rather than two calls to Less.
+type Comparer interface {
+	Item
+	Compare(other Item) int
+}
+
 // An Iterator is a stateful iterator for BTrees.
 //
 // Iterators move either in-order or reverse in-order.
@@ -43,6 +80,56 @@ type Iterator struct {
 	curr       *node
 }
 
+// Options configures a BTree created with NewWithOptions.
+//
+// Exactly one of Order, MinDegree and NodeBytes must be set.
+type Options struct {
+	// Order is the maximum number of children each node can have. It must
+	// be at least 3.
+	Order int
+
+	// MinDegree is the minimum degree t of the tree, as defined by CLRS,
+	// for which every node has at most 2t-1 items. It only sets the Order
+	// to 2t, and must be at least 2.
+	//
+	// NOTE: Delete only rebalances a leaf once it is empty, so leaves may
+	// hold fewer than the t-1 items CLRS requires of nodes other than the
+	// root.
+	MinDegree int
+
+	// NodeBytes chooses the largest order whose full nodes, including their
+	// item and child slices, fit in this many bytes. It does not include
+	// memory referenced by the items themselves.
+	NodeBytes int
+
+	// FreeList is the FreeList which the tree allocates nodes from and
+	// frees them to, which may be shared with other trees. If nil, the
+	// tree has its own FreeList of DefaultFreeListSize.
+	FreeList *FreeList
+}
+
+// BulkloadOptions configures BulkloadChecked.
+type BulkloadOptions struct {
+	// FillFactor is the fraction of each node's capacity to fill, in the
+	// range (0, 1]. Leaving room in nodes makes subsequent inserts cheaper.
+	// The zero value fills nodes completely.
+	FillFactor float64
+}
+
+// An ItemDecoder reads a single Item from r.
+//
+// It returns io.EOF once r has no more items. Any other error, including
+// io.ErrUnexpectedEOF for a truncated item, aborts the read.
+type ItemDecoder func(r io.Reader) (Item, error)
+
+// A bulkloader builds a BTree by appending ascending items to its rightmost
+// leaf.
+type bulkloader struct {
+	tree *BTree
+	max  *node // Rightmost leaf of tree.
+	last Item  // Most recently added item.
+}
+
 type items []Item
 
 type children []*node
@@ -63,20 +150,61 @@ type node struct {
 // Duplicate values cannot be inserted. If the item to insert is found in the
 // tree, the method will fail silently.
 func (b *BTree) Insert(item Item) {
-	curr := b.root
-	for {
-		i := curr.items.find(item)
+	if leaf, _ := b.descend(b.root, item, nil); leaf != nil {
+		b.split(leaf, item)
+		b.notify(EventInsert, item)
+	}
+}
 
-		if curr.items.match(item, i-1) {
-			return
-		} else if i >= len(curr.children) {
-			break
+// InsertBatch inserts many items into the BTree. If needed, it also
+// rebalances the tree.
+//
+// The items are sorted first if they are not already in order. Rather than
+// descending from the root for each item, InsertBatch keeps inserting into
+// the current leaf for as long as the items belong there, and otherwise only
+// climbs as far as needed to reach the next item's leaf.
+//
+// As with Insert, items which are already in the tree are skipped silently.
+func (b *BTree) InsertBatch(batch []Item) {
+	less := func(i, j int) bool { return batch[i].Less(batch[j]) }
+	if !sort.SliceIsSorted(batch, less) {
+		batch = append([]Item(nil), batch...)
+		sort.Slice(batch, less)
+	}
+
+	curr := b.root
+	var leaf *node
+	var bound Item // Exclusive upper bound on the items which belong in leaf.
+	for _, item := range batch {
+		if leaf == nil || (bound != nil && !item.Less(bound)) {
+			// Climb until item falls within the subtree rooted at curr.
+			// Because items are ascending, only the upper bound on the
+			// subtree needs to be checked.
+			bound = nil
+			for curr.parent != nil {
+				i := curr.nthChildOfParent()
+				if i < len(curr.parent.items) && item.Less(curr.parent.items[i]) {
+					bound = curr.parent.items[i]
+					break
+				}
+				curr = curr.parent
+			}
+			if leaf, bound = b.descend(curr, item, bound); leaf == nil {
+				continue
+			}
+			curr = leaf
+		} else if _, found := leaf.items.findMatch(item); found {
+			continue
 		}
 
-		curr = curr.children[i]
+		size := len(leaf.items)
+		b.split(leaf, item)
+		if len(leaf.items) != size+1 {
+			// The leaf was split, so its upper bound has changed.
+			leaf = nil
+		}
+		b.notify(EventInsert, item)
 	}
-
-	b.split(curr, item)
 }
 
 // Delete deletes an item from the B-Tree. If needed, it also rebalances the
@@ -89,6 +217,8 @@ func (b *BTree) Delete(item Item) {
 	if i == -1 {
 		return
 	}
+	deleted := del.items[i]
+	defer b.notify(EventDelete, deleted)
 	// 1. Delete the item from its container node.
 	// The container node must be either an internal node or a leaf.
 	// If it is a leaf, we can simply delete the item, as leaves do not
@@ -119,12 +249,26 @@ func (b *BTree) Delete(item Item) {
 
 // Search searches for an item in the Btree.
 //
+// If the item is found, the method returns it and true.
+// Otherwise, the function returns nil and false.
+func (b *BTree) Search(item Item) (Item, bool) {
+	container, index := b.search(item)
+	if index == -1 {
+		return nil, false
+	}
+	return container.items[index], true
+}
+
+// SearchRef searches for an item in the Btree.
+//
 // If the item is found, the method returns a pointer to it.
-// Otherwise, the function returns nil and an error indicating failure.
-func (b *BTree) Search(item Item) (*Item, error) {
+// Otherwise, the function returns nil and ErrNotFound.
+//
+// Deprecated: Use Search, which does not allocate an error.
+func (b *BTree) SearchRef(item Item) (*Item, error) {
 	container, index := b.search(item)
 	if index == -1 {
-		return nil, errors.New("item not found in BTree")
+		return nil, ErrNotFound
 	}
 	return &container.items[index], nil
 }
@@ -151,6 +295,18 @@ func (b *BTree) NewReverseIterator() *Iterator {
 	}
 }
 
+// NewIteratorFrom returns a new iterator for the BTree, which starts at the
+// smallest item greater than or equal to item.
+func (b *BTree) NewIteratorFrom(item Item) *Iterator {
+	return b.seek(item, forward)
+}
+
+// NewReverseIteratorFrom returns a new reverse iterator for the BTree, which
+// starts at the largest item less than or equal to item.
+func (b *BTree) NewReverseIteratorFrom(item Item) *Iterator {
+	return b.seek(item, reverse)
+}
+
 // HasNext determines if iterator can iterate.
 func (bi *Iterator) HasNext() bool {
 	return bi.curr != nil && len(bi.curr.items) != 0
@@ -159,7 +315,7 @@ func (bi *Iterator) HasNext() bool {
 // Next moves the iterator forward and returns its previous value.
 func (bi *Iterator) Next() (Item, error) {
 	if !bi.HasNext() {
-		return nil, errors.New("Iterator does not have next")
+		return nil, ErrIteratorExhausted
 	}
 
 	curr := bi.curr
@@ -228,7 +384,7 @@ func (b *BTree) split(node *node, item Item) {
 
 	mid := len(node.items) / 2
 	midItem := node.items[mid]
-	rightNode := newNode(b.order, nil, nil, node.parent)
+	rightNode := b.newNode(node.parent)
 	rightNode.items = append(rightNode.items, node.items[mid+1:]...)
 	node.items.truncate(mid)
 	if len(node.children) > 0 {
@@ -240,7 +396,9 @@ func (b *BTree) split(node *node, item Item) {
 	}
 
 	if node.parent == nil {
-		newRoot := newNode(b.order, items{midItem}, children{node, rightNode}, nil)
+		newRoot := b.newNode(nil)
+		newRoot.items = append(newRoot.items, midItem)
+		newRoot.children = append(newRoot.children, node, rightNode)
 		node.parent = newRoot
 		rightNode.parent = newRoot
 		b.root = newRoot
@@ -248,9 +406,7 @@ func (b *BTree) split(node *node, item Item) {
 	}
 
 	i := node.parent.items.find(item)
-	node.parent.children = append(node.parent.children, nil)
-	copy(node.parent.children[i+1:], node.parent.children[i:])
-	node.parent.children[i+1] = rightNode
+	node.parent.children.insertAt(i+1, rightNode)
 	b.split(node.parent, midItem)
 }
 
@@ -289,13 +445,13 @@ func (b *BTree) rebalance(n *node, minItems int) {
 	// Right rotation
 	// NOTE: Important to also copy child nodes.
 	if sibling = leftSib; sibling != nil && len(sibling.items) > minItems {
-		n.items = append(items{n.parent.items[lSepPos]}, n.items...)
+		n.items.insertAt(0, n.parent.items[lSepPos])
 		n.parent.items[lSepPos] = sibling.items[len(sibling.items)-1]
 		sibling.items.delete(len(sibling.items) - 1)
 		if len(sibling.children) > 0 {
 			lastChild := sibling.children[len(sibling.children)-1]
 			lastChild.parent = n
-			n.children = append(children{lastChild}, n.children...)
+			n.children.insertAt(0, lastChild)
 			sibling.children.delete(len(sibling.children) - 1)
 		}
 		return
@@ -323,21 +479,74 @@ func (b *BTree) rebalance(n *node, minItems int) {
 		c.parent = left
 	}
 	left.children = append(left.children, right.children...)
-	n.parent.items.delete(sepPos)
-	n.parent.children.delete(rightPos)
+	parent := n.parent
+	parent.items.delete(sepPos)
+	parent.children.delete(rightPos)
+	b.freelist.freeNode(right)
 
 	// Left becomes new root if parent is root and empty.
-	if n.parent.parent == nil && len(n.parent.items) == 0 {
-		right.parent = left
+	if parent.parent == nil && len(parent.items) == 0 {
 		left.parent = nil
 		b.root = left
+		b.freelist.freeNode(parent)
 		return
 	}
 
 	// If B-Tree invariants don't hold for parent, rebalance around parent.
 	minItems = int(math.Ceil(float64(b.order)/2.0)) - 1
-	if len(n.parent.items) < minItems {
-		b.rebalance(n.parent, minItems)
+	if len(parent.items) < minItems {
+		b.rebalance(parent, minItems)
+	}
+}
+
+// descend descends from n to the leaf in which item belongs.
+// Along the way, bound is narrowed to the smallest item greater than item,
+// which is the exclusive upper bound on items belonging in the leaf.
+// If item is already present in the subtree rooted at n, the returned leaf is
+// nil.
+func (b *BTree) descend(n *node, item, bound Item) (*node, Item) {
+	curr := n
+	for {
+		i, found := curr.items.findMatch(item)
+		if found {
+			return nil, bound
+		} else if i < len(curr.items) {
+			bound = curr.items[i]
+		}
+		if i >= len(curr.children) {
+			return curr, bound
+		}
+
+		curr = curr.children[i]
+	}
+}
+
+// newNode returns an empty node from the tree's FreeList.
+//
+// The node's items and children are allocated at full capacity up front: a
+// node holds up to order items while it is being split, and one more child
+// than items, so they never need to grow.
+func (b *BTree) newNode(parent *node) *node {
+	n := b.freelist.newNode()
+	// Nodes freed by a tree of a lower order are too small.
+	if cap(n.items) < b.order {
+		n.items = make(items, 0, b.order)
+	}
+	if cap(n.children) < b.order+1 {
+		n.children = make(children, 0, b.order+1)
+	}
+	n.parent = parent
+	return n
+}
+
+// adopt gives a zero-value tree, whose nodes have been taken from other, the
+// FreeList and observers it lacks.
+func (b *BTree) adopt(other *BTree) {
+	if b.freelist == nil {
+		b.freelist = other.freelist
+	}
+	if b.observers == nil {
+		b.observers = other.observers
 	}
 }
 
@@ -347,8 +556,8 @@ func (b *BTree) rebalance(n *node, minItems int) {
 func (b *BTree) search(item Item) (*node, int) {
 	curr := b.root
 	for {
-		i := curr.items.find(item)
-		if curr.items.match(item, i-1) {
+		i, found := curr.items.findMatch(item)
+		if found {
 			return curr, i - 1
 		} else if i >= len(curr.children) {
 			return nil, -1
@@ -357,6 +566,43 @@ func (b *BTree) search(item Item) (*node, int) {
 	}
 }
 
+// seek returns an iterator in direction dir which starts at item, or at the
+// first item after it in that direction if item is not in the tree.
+func (b *BTree) seek(item Item, dir int) *Iterator {
+	iter := &Iterator{dir: dir}
+	// Nearest ancestor item after item in direction dir, where the iterator
+	// starts if the leaf has no such item.
+	var next *node
+	var nextIndex int
+	curr := b.root
+	for {
+		i, found := curr.items.findMatch(item)
+		if found {
+			next, nextIndex = curr, i-1
+			break
+		}
+		index := i
+		if dir == reverse {
+			index--
+		}
+		if 0 <= index && index < len(curr.items) {
+			next, nextIndex = curr, index
+		}
+		if len(curr.children) == 0 {
+			break
+		}
+		curr = curr.children[i]
+	}
+	if next == nil {
+		return iter
+	}
+	iter.curr, iter.itemIndex, iter.childIndex = next, nextIndex, nextIndex+1
+	if dir == reverse {
+		iter.childIndex = nextIndex
+	}
+	return iter
+}
+
 // max returns the rightmost node of a particular subtree.
 func (b *BTree) max(root *node) *node {
 	curr := root
@@ -379,27 +625,149 @@ func (b *BTree) min(root *node) *node {
 	}
 }
 
+// buildLevel groups one level's worth of sorted items into nodes of roughly
+// perNode items each. Neighbouring nodes are separated by a single item, and
+// these separators are returned to become the items of the level above.
+// If kids is non-nil, the nodes are internal nodes which adopt kids in order.
+func (b *BTree) buildLevel(its []Item, kids children, perNode, minItems int) (children, []Item) {
+	n := len(its)
+	// A level with count nodes holds n-(count-1) items, with the remaining
+	// count-1 items acting as separators. The smallest node holds
+	// (n-count+1)/count items and the largest holds n/count.
+	count := (n + perNode) / (perNode + 1)
+	for count > 1 && (n-count+1)/count < minItems {
+		count--
+	}
+	for n/count > b.order-1 {
+		count++
+	}
+
+	total := n - count + 1
+	level := make(children, 0, count)
+	seps := make([]Item, 0, count-1)
+	pos, kid := 0, 0
+	for i := 0; i < count; i++ {
+		size := total / count
+		if i < total%count {
+			size++
+		}
+		nd := b.newNode(nil)
+		nd.items = append(nd.items, its[pos:pos+size]...)
+		pos += size
+		if kids != nil {
+			nd.children = append(nd.children, kids[kid:kid+size+1]...)
+			for _, c := range nd.children {
+				c.parent = nd
+			}
+			kid += size + 1
+		}
+		level = append(level, nd)
+		if i < count-1 {
+			seps = append(seps, its[pos])
+			pos++
+		}
+	}
+	return level, seps
+}
+
+// add appends an item to the tree being built.
+//
+// NOTE: The item must be greater than every item added before it.
+func (bl *bulkloader) add(item Item) {
+	bl.tree.split(bl.max, item)
+	if bl.max.parent != nil && len(bl.max.parent.children) > 0 {
+		bl.max = bl.max.parent.children[len(bl.max.parent.children)-1]
+	}
+	bl.last = item
+}
+
+// addChecked appends an item to the tree being built, returning an error if
+// it is not greater than the previously added item.
+func (bl *bulkloader) addChecked(item Item) error {
+	if bl.last != nil && !bl.last.Less(item) {
+		return fmt.Errorf("items must be sorted and unique: %v is not greater than %v", item, bl.last)
+	}
+	bl.add(item)
+	return nil
+}
+
 // print prints a horizontal representation of the BTree.
 //
 // NOTE: Intended primarily for testing.
 func (b *BTree) print() {
-	print(b.root, "", true)
+	b.Dump(os.Stdout)
+}
+
+// Dump writes a horizontal representation of the BTree to w, with one line
+// per node showing the node's items.
+func (b *BTree) Dump(w io.Writer) error {
+	return fprint(w, b.root, "", true)
+}
+
+// WriteDOT writes a Graphviz DOT representation of the BTree to w.
+//
+// Each node is drawn as a record of its items, with an edge from the slot
+// between each pair of items to the corresponding child.
+func (b *BTree) WriteDOT(w io.Writer) error {
+	if _, err := io.WriteString(w, "digraph BTree {\n\tnode [shape=record];\n"); err != nil {
+		return err
+	}
+	if _, err := writeDOT(w, b.root, 0); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "}\n")
+	return err
 }
 
 // find returns the index of the item in items.
 // If item does not exist in items, return where it would be located
 // (where 0 <= index <= len(array)).
 func (its *items) find(it Item) int {
+	if c, ok := it.(Comparer); ok {
+		i, _ := its.findCompare(c)
+		return i
+	}
 	return sort.Search(len(*its), func(i int) bool { return it.Less((*its)[i]) })
 }
 
+// findMatch returns the index find returns for item, and whether the item
+// before that index is equal to item.
+func (its *items) findMatch(item Item) (int, bool) {
+	if c, ok := item.(Comparer); ok {
+		return its.findCompare(c)
+	}
+	i := its.find(item)
+	return i, its.match(item, i-1)
+}
+
+// findCompare is find for a Comparer, which also reports whether the item
+// before the returned index is equal to item. The search stops as soon as it
+// finds an equal item.
+func (its *items) findCompare(item Comparer) (int, bool) {
+	lo, hi := 0, len(*its)
+	for lo < hi {
+		mid := int(uint(lo+hi) >> 1)
+		switch c := item.Compare((*its)[mid]); {
+		case c == 0:
+			return mid + 1, true
+		case c < 0:
+			hi = mid
+		default:
+			lo = mid + 1
+		}
+	}
+	return lo, false
+}
+
 // match checks if item and given index is equal to given item.
 func (its *items) match(item Item, index int) bool {
-	if index >= 0 && index < len(*its) &&
-		!(item.Less((*its)[index]) || (*its)[index].Less(item)) {
-		return true
+	if index < 0 || index >= len(*its) {
+		return false
+	}
+	if c, ok := item.(Comparer); ok {
+		return c.Compare((*its)[index]) == 0
 	}
-	return false
+	return !(item.Less((*its)[index]) || (*its)[index].Less(item))
 }
 
 // insert inserts the item into items.
@@ -412,6 +780,13 @@ func (its *items) insert(it Item) int {
 	return i
 }
 
+// insertAt inserts an item into items at the given index.
+func (its *items) insertAt(index int, it Item) {
+	*its = append(*its, nil)
+	copy((*its)[index+1:], (*its)[index:])
+	(*its)[index] = it
+}
+
 func (its *items) truncate(newLen int) {
 	for i := newLen; i < len(*its); i++ {
 		(*its)[i] = nil
@@ -425,6 +800,13 @@ func (its *items) delete(index int) {
 	*its = (*its)[:len(*its)-1]
 }
 
+// insertAt inserts a child into children at the given index.
+func (chi *children) insertAt(index int, c *node) {
+	*chi = append(*chi, nil)
+	copy((*chi)[index+1:], (*chi)[index:])
+	(*chi)[index] = c
+}
+
 func (chi *children) delete(index int) {
 	copy((*chi)[index:], (*chi)[index+1:])
 	(*chi)[len(*chi)-1] = nil
@@ -465,11 +847,39 @@ func (n *node) nthChildOfParent() int {
 //=============================================================================
 
 // New returns a new BTree.
+//
+// NOTE: The order is not validated, and orders below 3 produce trees which do
+// not behave as B-Trees. Use NewWithOptions to validate it.
 func New(order int) *BTree {
-	return &BTree{
-		order: order,
-		root:  newNode(order, nil, nil, nil),
+	return newTree(order, NewFreeList(DefaultFreeListSize))
+}
+
+// NewWithOptions returns a new BTree configured by opts.
+// It returns ErrInvalidOrder if the resulting order is less than 3.
+func NewWithOptions(opts Options) (*BTree, error) {
+	order := opts.Order
+	set := 0
+	if opts.Order != 0 {
+		set++
+	}
+	if opts.MinDegree != 0 {
+		order = 2 * opts.MinDegree
+		set++
 	}
+	if opts.NodeBytes != 0 {
+		order = orderForNodeBytes(opts.NodeBytes)
+		set++
+	}
+	if set != 1 {
+		return nil, errors.New("exactly one of Order, MinDegree and NodeBytes must be set")
+	}
+	if order < 3 {
+		return nil, ErrInvalidOrder
+	}
+	if opts.FreeList == nil {
+		opts.FreeList = NewFreeList(DefaultFreeListSize)
+	}
+	return newTree(order, opts.FreeList), nil
 }
 
 // Bulkload initializes a BTree using a sorted array of Items.
@@ -478,22 +888,113 @@ func New(order int) *BTree {
 // contains duplicates. It is the caller's responsibility to ensure that their
 // data is properly formatted.
 func Bulkload(order int, items items) *BTree {
-	b := New(order)
-	max := b.root
+	bl := newBulkloader(order)
 	for i := 0; i < len(items); i++ {
-		b.split(max, items[i])
-		if max.parent != nil && len(max.parent.children) > 0 {
-			max = max.parent.children[len(max.parent.children)-1]
+		bl.add(items[i])
+	}
+	return bl.tree
+}
+
+// BulkloadChecked initializes a BTree using a sorted array of Items.
+//
+// Unlike Bulkload, it returns an error if the items are not in strictly
+// ascending order. The tree is built bottom-up one level at a time, with each
+// node filled to roughly opts.FillFactor of its capacity.
+func BulkloadChecked(order int, items []Item, opts BulkloadOptions) (*BTree, error) {
+	if order < 3 {
+		return nil, ErrInvalidOrder
+	}
+	fill := opts.FillFactor
+	if fill == 0 {
+		fill = 1
+	}
+	if !(fill > 0 && fill <= 1) {
+		return nil, errors.New("fill factor must be in the range (0, 1]")
+	}
+	for i := 1; i < len(items); i++ {
+		if !items[i-1].Less(items[i]) {
+			return nil, fmt.Errorf("items must be sorted and unique: item %d is not greater than item %d", i, i-1)
 		}
+	}
 
+	b := New(order)
+	if len(items) == 0 {
+		return b, nil
+	}
+
+	// Every node except the root must hold at least minItems items, so the
+	// target is clamped to keep the tree valid for any fill factor.
+	minItems := int(math.Ceil(float64(order)/2.0)) - 1
+	perNode := int(fill*float64(order-1) + 0.5)
+	if perNode < minItems {
+		perNode = minItems
+	}
+
+	level, seps := b.buildLevel(items, nil, perNode, minItems)
+	for len(level) > 1 {
+		level, seps = b.buildLevel(seps, level, perNode, minItems)
+	}
+	b.root = level[0]
+	return b, nil
+}
+
+// BulkloadFrom initializes a BTree from a stream of sorted Items.
+//
+// Items are pulled by calling next until it reports false. The tree is built
+// in a single pass and, apart from the tree itself, only the most recent item
+// is retained. An error is returned if the items are not in strictly
+// ascending order.
+func BulkloadFrom(order int, next func() (Item, bool)) (*BTree, error) {
+	if order < 3 {
+		return nil, ErrInvalidOrder
+	}
+	bl := newBulkloader(order)
+	for {
+		item, ok := next()
+		if !ok {
+			return bl.tree, nil
+		}
+		if err := bl.addChecked(item); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// BulkloadReader initializes a BTree from sorted Items read from r.
+//
+// Items are decoded one at a time by decode until it returns io.EOF. As with
+// BulkloadFrom, the items must be in strictly ascending order.
+//
+// Unless r is an io.ByteReader, such as a *bufio.Reader or *bytes.Buffer, it
+// is wrapped in a bufio.Reader, which may consume bytes after the last item.
+// Callers which read on from r after the items should pass an io.ByteReader.
+func BulkloadReader(order int, r io.Reader, decode ItemDecoder) (*BTree, error) {
+	if order < 3 {
+		return nil, ErrInvalidOrder
+	}
+	if _, ok := r.(io.ByteReader); !ok {
+		r = bufio.NewReader(r)
+	}
+	bl := newBulkloader(order)
+	for {
+		item, err := decode(r)
+		if err == io.EOF {
+			return bl.tree, nil
+		} else if err != nil {
+			return nil, err
+		}
+		if err := bl.addChecked(item); err != nil {
+			return nil, err
+		}
 	}
-	return b
 }
 
 // Merge merges two BTrees into a single BTree which it returns.
+//
+// Items which are in both trees are kept once, from a.
 func Merge(a, b *BTree) (*BTree, error) {
 	if a.order != b.order {
-		return nil, errors.New("Merged BTrees must have same order")
+		return nil, ErrOrderMismatch
 	}
 
 	aIter := a.NewIterator()
@@ -520,6 +1021,11 @@ func Merge(a, b *BTree) (*BTree, error) {
 			merged = append(merged, bNext)
 			oldA = aNext
 			oldB = nil
+		} else {
+			// Equal items are only kept once, from a.
+			merged = append(merged, aNext)
+			oldA = nil
+			oldB = nil
 		}
 	}
 
@@ -528,36 +1034,77 @@ func Merge(a, b *BTree) (*BTree, error) {
 	return mt, nil
 }
 
-// newNode returns a new node.
-func newNode(order int, i items, c children, parent *node) *node {
-	return &node{
-		items:    i,
-		children: c,
-		parent:   parent,
-	}
+// orderForNodeBytes returns the largest order whose full nodes fit in
+// nodeBytes bytes.
+//
+// A full node holds up to order items while it is being split, and one more
+// child than items.
+func orderForNodeBytes(nodeBytes int) int {
+	nodeSize := int(unsafe.Sizeof(node{}))
+	itemSize := int(unsafe.Sizeof(Item(nil)))
+	childSize := int(unsafe.Sizeof((*node)(nil)))
+	return (nodeBytes - nodeSize - childSize) / (itemSize + childSize)
 }
 
-// print recursively prints a horizontal representation of the BTree.
-func print(n *node, prefix string, isTail bool) {
+// newBulkloader returns a bulkloader for an empty BTree.
+func newBulkloader(order int) *bulkloader {
+	b := New(order)
+	return &bulkloader{tree: b, max: b.root}
+}
+
+// newTree returns a new BTree which allocates nodes from freelist.
+func newTree(order int, freelist *FreeList) *BTree {
+	b := &BTree{order: order, freelist: freelist, observers: &observers{}}
+	b.root = b.newNode(nil)
+	return b
+}
+
+// fprint recursively writes a horizontal representation of the BTree to w.
+func fprint(w io.Writer, n *node, prefix string, isTail bool) error {
 	split, tail, vert, gap := "├──", "└──", "│   ", "    "
+	branch, indent := split, vert
 	if isTail {
-		fmt.Printf("%s%v\n", prefix+tail, n.items)
-	} else {
-		fmt.Printf("%s%v\n", prefix+split, n.items)
+		branch, indent = tail, gap
 	}
-	var i int
-	for i = 0; i < len(n.children)-1; i++ {
-		if isTail {
-			print(n.children[i], prefix+gap, false)
-		} else {
-			print(n.children[i], prefix+vert, false)
+	if _, err := fmt.Fprintf(w, "%s%v\n", prefix+branch, n.items); err != nil {
+		return err
+	}
+	for i, c := range n.children {
+		if err := fprint(w, c, prefix+indent, i == len(n.children)-1); err != nil {
+			return err
 		}
 	}
-	if len(n.children) > 0 {
-		if isTail {
-			print(n.children[i], prefix+gap, true)
-		} else {
-			print(n.children[i], prefix+vert, true)
+	return nil
+}
+
+// dotEscaper escapes characters with special meaning in Graphviz record
+// labels.
+var dotEscaper = strings.NewReplacer(
+	`\`, `\\`, `"`, `\"`, `|`, `\|`, `{`, `\{`, `}`, `\}`, `<`, `\<`, `>`, `\>`,
+)
+
+// writeDOT recursively writes the nodes and edges of the subtree rooted at n
+// in DOT format. Nodes are named by their pre-order position, starting from
+// id, and the id following the subtree is returned.
+func writeDOT(w io.Writer, n *node, id int) (int, error) {
+	var label strings.Builder
+	for i, item := range n.items {
+		fmt.Fprintf(&label, "<c%d> |%s|", i, dotEscaper.Replace(fmt.Sprint(item)))
+	}
+	fmt.Fprintf(&label, "<c%d> ", len(n.items))
+	if _, err := fmt.Fprintf(w, "\tn%d [label=\"%s\"];\n", id, label.String()); err != nil {
+		return 0, err
+	}
+
+	next := id + 1
+	for i, c := range n.children {
+		if _, err := fmt.Fprintf(w, "\tn%d:c%d -> n%d;\n", id, i, next); err != nil {
+			return 0, err
+		}
+		var err error
+		if next, err = writeDOT(w, c, next); err != nil {
+			return 0, err
 		}
 	}
+	return next, nil
 }
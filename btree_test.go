@@ -1,10 +1,17 @@
 package btree
 
 import (
+	"bytes"
+	"cmp"
+	"encoding/binary"
+	"errors"
 	"fmt"
+	"io"
 	"math/rand"
+	"strings"
 	"testing"
 	"time"
+	"unsafe"
 )
 
 func init() {
@@ -42,6 +49,171 @@ func TestInsert(t *testing.T) {
 	}
 }
 
+func TestNewWithOptions(t *testing.T) {
+	cases := []struct {
+		opts      Options
+		wantOrder int
+		wantErr   error
+	}{
+		// Should accept valid orders and minimum degrees
+		{opts: Options{Order: 3}, wantOrder: 3},
+		{opts: Options{Order: 64}, wantOrder: 64},
+		{opts: Options{MinDegree: 2}, wantOrder: 4},
+		{opts: Options{MinDegree: 10}, wantOrder: 20},
+		// Should choose an order which fits the node size
+		{opts: Options{NodeBytes: 4096}, wantOrder: orderForNodeBytes(4096)},
+		// Should reject invalid orders
+		{opts: Options{Order: 2}, wantErr: ErrInvalidOrder},
+		{opts: Options{Order: -1}, wantErr: ErrInvalidOrder},
+		{opts: Options{MinDegree: 1}, wantErr: ErrInvalidOrder},
+		{opts: Options{NodeBytes: 64}, wantErr: ErrInvalidOrder},
+		// Should require exactly one setting
+		{opts: Options{}},
+		{opts: Options{Order: 4, MinDegree: 2}},
+	}
+
+	for _, c := range cases {
+		b, err := NewWithOptions(c.opts)
+		if c.wantOrder == 0 {
+			if err == nil || (c.wantErr != nil && !errors.Is(err, c.wantErr)) {
+				t.Errorf("NewWithOptions(%+v) should have failed with %v. Got: %v", c.opts, c.wantErr, err)
+			}
+			continue
+		}
+		if err != nil || b.order != c.wantOrder {
+			t.Errorf("NewWithOptions(%+v) should have returned order %d. Got: %v, error: %v", c.opts, c.wantOrder, b, err)
+			continue
+		}
+		for _, item := range uniqueInputsN(500) {
+			b.Insert(item)
+		}
+		if err := b.Validate(); err != nil {
+			t.Errorf("Tree should be valid: %v", err)
+		}
+	}
+
+	// The largest order whose full nodes fit should be chosen
+	nodeSize := func(order int) int {
+		return int(unsafe.Sizeof(node{})) + order*int(unsafe.Sizeof(Item(nil))) + (order+1)*int(unsafe.Sizeof((*node)(nil)))
+	}
+	for _, size := range []int{256, 1024, 4096} {
+		order := orderForNodeBytes(size)
+		if nodeSize(order) > size || nodeSize(order+1) <= size {
+			t.Errorf("Order %d should be the largest whose nodes fit in %d bytes", order, size)
+		}
+	}
+}
+
+func TestNodeCapacity(t *testing.T) {
+	massItems := uniqueInputsN(2000)
+	for _, order := range []int{3, 4, 7, 16} {
+		b, _ := NewWithOptions(Options{Order: order, FreeList: NewFreeList(len(massItems))})
+		for _, item := range massItems {
+			b.Insert(item)
+		}
+		for _, item := range massItems[:1500] {
+			b.Delete(item)
+		}
+		b.InsertBatch(massItems)
+
+		// Node storage should never have been reallocated
+		var walk func(n *node)
+		walk = func(n *node) {
+			if cap(n.items) != order || cap(n.children) != order+1 {
+				t.Fatalf("Order %d node should have capacities %d and %d. Got: %d and %d",
+					order, order, order+1, cap(n.items), cap(n.children))
+			}
+			for _, c := range n.children {
+				walk(c)
+			}
+		}
+		walk(b.root)
+
+		// Churn should not allocate once the FreeList holds enough nodes
+		allocs := testing.AllocsPerRun(100, func() {
+			for _, item := range massItems[:500] {
+				b.Delete(item)
+			}
+			for _, item := range massItems[:500] {
+				b.Insert(item)
+			}
+		})
+		if allocs != 0 {
+			t.Errorf("Order %d churn should not allocate. Got: %v allocations", order, allocs)
+		}
+	}
+}
+
+func TestInsertBatch(t *testing.T) {
+	massItems := uniqueInputsN(1000)
+	emptyItems := uniqueInputsN(0)
+	shuffled := uniqueInputsN(1000)
+	rand.Shuffle(len(shuffled), func(i, j int) { shuffled[i], shuffled[j] = shuffled[j], shuffled[i] })
+	evens, odds := make([]Item, 0, 500), make([]Item, 0, 500)
+	for i, item := range massItems {
+		if i%2 == 0 {
+			evens = append(evens, item)
+		} else {
+			odds = append(odds, item)
+		}
+	}
+	cases := []struct {
+		items []Item
+		batch []Item
+		order int
+	}{
+		// Should insert sorted batches into empty trees
+		{items: emptyItems, batch: massItems, order: 3},
+		{items: emptyItems, batch: massItems, order: 8},
+		// Should insert unsorted batches
+		{items: emptyItems, batch: shuffled, order: 5},
+		// Should interleave batch with existing items
+		{items: evens, batch: odds, order: 3},
+		{items: odds, batch: evens, order: 11},
+		// Should skip items already in the tree
+		{items: evens, batch: massItems, order: 4},
+		{items: massItems, batch: shuffled, order: 6},
+		// Should do nothing for an empty batch
+		{items: massItems, batch: emptyItems, order: 3},
+	}
+
+	for _, c := range cases {
+		b := New(c.order)
+		for _, item := range c.items {
+			b.Insert(item)
+		}
+		batch := append([]Item(nil), c.batch...)
+		b.InsertBatch(batch)
+
+		if !isValidBTree(b) {
+			b.print()
+			t.Fatalf("After InsertBatch: BTree is not valid\n")
+		}
+		for i := range batch {
+			if batch[i] != c.batch[i] {
+				t.Fatalf("InsertBatch should not reorder the caller's slice")
+			}
+		}
+
+		want := make(map[int]bool)
+		for _, item := range append(c.items, c.batch...) {
+			want[item.(*testItem).key] = true
+		}
+		iter := b.NewIterator()
+		count := 0
+		for iter.HasNext() {
+			next, _ := iter.Next()
+			if !want[next.(*testItem).key] {
+				t.Fatalf("Tree contains unexpected item %v", next)
+			}
+			count++
+		}
+		if count != len(want) {
+			t.Fatalf("Tree should contain %d items, but contains %d", len(want), count)
+		}
+	}
+}
+
 func TestDelete(t *testing.T) {
 	massItems := uniqueInputsN(1000)
 	emptyItems := uniqueInputsN(0)
@@ -78,7 +250,7 @@ func TestDelete(t *testing.T) {
 
 			if c.shouldAlterTree {
 				_, presentAfter := b.Search(d)
-				if presentBefore != nil || presentAfter == nil {
+				if !presentBefore || presentAfter {
 					t.Errorf("Item should have been deleted from tree\n")
 				}
 			}
@@ -121,12 +293,20 @@ func TestSearch(t *testing.T) {
 		}
 
 		for _, target := range c.lookFor {
-			res, err := b.Search(target)
-			if (res == nil || err != nil) && c.shouldFind == true {
+			res, found := b.Search(target)
+			if (res == nil || !found) && c.shouldFind == true {
 				t.Errorf("Should have found: %v\n", target)
-			} else if (res != nil || err == nil) && c.shouldFind == false {
+			} else if (res != nil || found) && c.shouldFind == false {
 				t.Errorf("Should not have found: %v\n", target)
 			}
+
+			// The deprecated SearchRef should agree with Search
+			ref, err := b.SearchRef(target)
+			if c.shouldFind && (err != nil || *ref != res) {
+				t.Errorf("SearchRef should have found: %v\n", target)
+			} else if !c.shouldFind && (ref != nil || !errors.Is(err, ErrNotFound)) {
+				t.Errorf("SearchRef should have returned ErrNotFound. Got: %v\n", err)
+			}
 		}
 	}
 }
@@ -176,7 +356,7 @@ func TestIteratorNext(t *testing.T) {
 				t.Fatalf("Iterator should no longer have next")
 			}
 			extraIterVal, err := iter.Next()
-			if extraIterVal != nil || err == nil {
+			if extraIterVal != nil || !errors.Is(err, ErrIteratorExhausted) {
 				t.Fatalf("Extra call to Next() should have returned nil value and error."+
 					"Instead got val: %v, and error: %v", extraIterVal, err)
 			}
@@ -228,7 +408,7 @@ func TestIteratorReverseNext(t *testing.T) {
 				t.Errorf("Iterator should no longer have next")
 			}
 			extraIterVal, err := iter.Next()
-			if extraIterVal != nil || err == nil {
+			if extraIterVal != nil || !errors.Is(err, ErrIteratorExhausted) {
 				t.Errorf("Extra call to Next() should have returned nil value and error."+
 					"Instead got val: %v, and error: %v", extraIterVal, err)
 			}
@@ -236,6 +416,57 @@ func TestIteratorReverseNext(t *testing.T) {
 	}
 }
 
+func TestIteratorFrom(t *testing.T) {
+	cases := []struct {
+		n     int
+		order int
+	}{
+		// Should work for trees of various orders
+		{n: 200, order: 3},
+		{n: 200, order: 4},
+		{n: 200, order: 15},
+		// Should work for empty trees
+		{n: 0, order: 3},
+		// Should work for tree with single item
+		{n: 1, order: 3},
+	}
+
+	for _, c := range cases {
+		// Only even keys are inserted, so odd keys seek to a neighbour.
+		b := New(c.order)
+		for _, i := range rand.Perm(c.n) {
+			b.Insert(&testItem{key: 2 * i})
+		}
+		for key := -1; key <= 2*c.n; key++ {
+			// Should start at the smallest key not less than key
+			want := max(key+key&1, 0)
+			iter := b.NewIteratorFrom(&testItem{key: key})
+			for ; want < 2*c.n; want += 2 {
+				next, err := iter.Next()
+				if err != nil || next.(*testItem).key != want {
+					t.Fatalf("Iterator from %d should have returned %d. Got: %v, error: %v", key, want, next, err)
+				}
+			}
+			if iter.HasNext() {
+				t.Fatalf("Iterator from %d should no longer have next", key)
+			}
+
+			// Should start at the largest key not greater than key
+			want = min(key-key&1, 2*c.n-2)
+			iter = b.NewReverseIteratorFrom(&testItem{key: key})
+			for ; want >= 0; want -= 2 {
+				next, err := iter.Next()
+				if err != nil || next.(*testItem).key != want {
+					t.Fatalf("Reverse iterator from %d should have returned %d. Got: %v, error: %v", key, want, next, err)
+				}
+			}
+			if iter.HasNext() {
+				t.Fatalf("Reverse iterator from %d should no longer have next", key)
+			}
+		}
+	}
+}
+
 func TestBulkload(t *testing.T) {
 	massItems := uniqueInputsN(1000)
 	cases := []struct {
@@ -258,6 +489,152 @@ func TestBulkload(t *testing.T) {
 	}
 }
 
+func TestBulkloadChecked(t *testing.T) {
+	massItems := uniqueInputsN(1000)
+	emptyItems := uniqueInputsN(0)
+	unsorted := uniqueInputsN(100)
+	unsorted[10], unsorted[20] = unsorted[20], unsorted[10]
+	dupItems := uniqueInputsN(100)
+	dupItems[50] = dupItems[49]
+	cases := []struct {
+		items      []Item
+		order      int
+		fill       float64
+		shouldFail bool
+	}{
+		// Should build full trees of various orders
+		{items: massItems, order: 3},
+		{items: massItems, order: 8},
+		{items: massItems, order: 121},
+		// Should build partially filled trees
+		{items: massItems, order: 3, fill: 0.5},
+		{items: massItems, order: 8, fill: 0.7},
+		{items: massItems, order: 50, fill: 0.1},
+		// Should work for empty input
+		{items: emptyItems, order: 4},
+		// Should reject unsorted or duplicate input
+		{items: unsorted, order: 4, shouldFail: true},
+		{items: dupItems, order: 4, shouldFail: true},
+		// Should reject invalid orders and fill factors
+		{items: massItems, order: 2, shouldFail: true},
+		{items: massItems, order: 5, fill: 1.5, shouldFail: true},
+		{items: massItems, order: 5, fill: -0.5, shouldFail: true},
+	}
+
+	for _, c := range cases {
+		bt, err := BulkloadChecked(c.order, c.items, BulkloadOptions{FillFactor: c.fill})
+		if c.shouldFail {
+			if err == nil {
+				t.Errorf("BulkloadChecked should have failed for order %d, fill %v\n", c.order, c.fill)
+			} else if c.order < 3 && !errors.Is(err, ErrInvalidOrder) {
+				t.Errorf("BulkloadChecked should have returned ErrInvalidOrder. Got: %v\n", err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("BulkloadChecked should not have failed: %v\n", err)
+		}
+		if !isValidBTree(bt) {
+			bt.print()
+			t.Fatalf("Bulkloaded tree is not valid\n")
+		}
+
+		iter := bt.NewIterator()
+		for i := 0; i < len(c.items); i++ {
+			next, err := iter.Next()
+			if err != nil || next != c.items[i] {
+				t.Fatalf("Bulkloaded tree should contain items in order. Want: %v, Got: %v", c.items[i], next)
+			}
+		}
+		if iter.HasNext() {
+			t.Fatalf("Bulkloaded tree should not contain extra items")
+		}
+
+		// Tree should remain valid under further modification.
+		for _, item := range c.items {
+			bt.Delete(item)
+			if !isValidBTree(bt) {
+				bt.print()
+				t.Fatalf("Bulkloaded tree is not valid after deleting %v\n", item)
+			}
+		}
+	}
+}
+
+func TestBulkloadFrom(t *testing.T) {
+	massItems := uniqueInputsN(1000)
+	emptyItems := uniqueInputsN(0)
+	unsorted := uniqueInputsN(100)
+	unsorted[10], unsorted[20] = unsorted[20], unsorted[10]
+	cases := []struct {
+		items      []Item
+		order      int
+		shouldFail bool
+	}{
+		// Should load streams into trees of various orders
+		{items: massItems, order: 3},
+		{items: massItems, order: 8},
+		{items: massItems, order: 50},
+		// Should work for empty streams
+		{items: emptyItems, order: 4},
+		// Should reject unsorted streams
+		{items: unsorted, order: 4, shouldFail: true},
+		// Should reject invalid orders
+		{items: massItems, order: 1, shouldFail: true},
+	}
+
+	for _, c := range cases {
+		i := 0
+		next := func() (Item, bool) {
+			if i == len(c.items) {
+				return nil, false
+			}
+			i++
+			return c.items[i-1], true
+		}
+		bt, err := BulkloadFrom(c.order, next)
+		checkLoaded(t, bt, err, c.items, c.shouldFail)
+
+		var buf bytes.Buffer
+		for _, item := range c.items {
+			ti := item.(*testItem)
+			binary.Write(&buf, binary.BigEndian, [2]int64{int64(ti.key), int64(ti.val)})
+		}
+		bt, err = BulkloadReader(c.order, &buf, decodeTestItem)
+		checkLoaded(t, bt, err, c.items, c.shouldFail)
+	}
+
+	// Should report errors from the decoder
+	var buf bytes.Buffer
+	binary.Write(&buf, binary.BigEndian, [2]int64{1, 1})
+	buf.WriteByte(0)
+	if _, err := BulkloadReader(3, &buf, decodeTestItem); err != io.ErrUnexpectedEOF {
+		t.Errorf("BulkloadReader should have failed on truncated input. Got error: %v", err)
+	}
+
+	// Should leave data after the items in a buffered reader unread
+	buf.Reset()
+	items := uniqueInputsN(100)
+	for _, item := range items {
+		ti := item.(*testItem)
+		binary.Write(&buf, binary.BigEndian, [2]int64{int64(ti.key), int64(ti.val)})
+	}
+	binary.Write(&buf, binary.BigEndian, [2]int64{-1, 0})
+	buf.WriteString("trailer")
+	decodeUntilEnd := func(r io.Reader) (Item, error) {
+		item, err := decodeTestItem(r)
+		if err == nil && item.(*testItem).key == -1 {
+			return nil, io.EOF
+		}
+		return item, err
+	}
+	bt, err := BulkloadReader(4, &buf, decodeUntilEnd)
+	checkLoaded(t, bt, err, items, false)
+	if rest := buf.String(); rest != "trailer" {
+		t.Errorf("BulkloadReader should have left %q unread, but left %q", "trailer", rest)
+	}
+}
+
 func TestMerge(t *testing.T) {
 	first := uniqueInputsN(2000)
 	distinct := uniqueInputsN(2000)
@@ -293,6 +670,107 @@ func TestMerge(t *testing.T) {
 			t.Errorf("Merged tree should have been valid")
 		}
 	}
+
+	// Should keep items which are in both trees
+	a := Bulkload(3, []Item{&testItem{key: 1}, &testItem{key: 2}, &testItem{key: 4}})
+	b := Bulkload(3, []Item{&testItem{key: 2}, &testItem{key: 3}, &testItem{key: 4}})
+	mt, err := Merge(a, b)
+	checkLoaded(t, mt, err, []Item{&testItem{key: 1}, &testItem{key: 2}, &testItem{key: 3}, &testItem{key: 4}}, false)
+
+	// Should reject trees of different orders
+	if _, err := Merge(New(3), New(4)); !errors.Is(err, ErrOrderMismatch) {
+		t.Errorf("Merge should have returned ErrOrderMismatch. Got: %v", err)
+	}
+}
+
+func TestDump(t *testing.T) {
+	cases := []struct {
+		items []Item
+		order int
+	}{
+		{items: uniqueInputsN(0), order: 3},
+		{items: uniqueInputsN(1), order: 3},
+		{items: uniqueInputsN(1000), order: 3},
+		{items: uniqueInputsN(1000), order: 12},
+	}
+
+	for _, c := range cases {
+		b := Bulkload(c.order, c.items)
+		nodes := b.Stats().Nodes
+
+		var buf bytes.Buffer
+		if err := b.Dump(&buf); err != nil {
+			t.Fatalf("Dump should not have failed: %v", err)
+		}
+		if lines := strings.Count(buf.String(), "\n"); lines != nodes {
+			t.Errorf("Dump should write one line per node. Want: %d, Got: %d", nodes, lines)
+		}
+
+		buf.Reset()
+		if err := b.WriteDOT(&buf); err != nil {
+			t.Fatalf("WriteDOT should not have failed: %v", err)
+		}
+		dot := buf.String()
+		if !strings.HasPrefix(dot, "digraph BTree {") || !strings.HasSuffix(dot, "}\n") {
+			t.Errorf("WriteDOT should write a digraph. Got: %s", dot)
+		}
+		if labels := strings.Count(dot, "[label="); labels != nodes {
+			t.Errorf("WriteDOT should write one label per node. Want: %d, Got: %d", nodes, labels)
+		}
+		if edges := strings.Count(dot, "->"); edges != nodes-1 {
+			t.Errorf("WriteDOT should write one edge per child. Want: %d, Got: %d", nodes-1, edges)
+		}
+
+		if err := b.Dump(failingWriter{}); err == nil {
+			t.Errorf("Dump should have returned the writer's error")
+		}
+		if err := b.WriteDOT(failingWriter{}); err == nil {
+			t.Errorf("WriteDOT should have returned the writer's error")
+		}
+	}
+}
+
+func TestComparer(t *testing.T) {
+	for _, order := range []int{3, 4, 16} {
+		var lessCalls, compareCalls int
+		withLess, withCompare := New(order), New(order)
+		for i := 0; i < 5000; i++ {
+			key := rand.Intn(500)
+			less, comparer := &countedItem{key, &lessCalls}, &countedComparer{key, &compareCalls}
+			switch rand.Intn(3) {
+			case 0:
+				withLess.Insert(less)
+				withCompare.Insert(comparer)
+			case 1:
+				withLess.Delete(less)
+				withCompare.Delete(comparer)
+			default:
+				// Should find the same items as with Less
+				_, found := withLess.Search(less)
+				if _, ok := withCompare.Search(comparer); ok != found {
+					t.Fatalf("Search(%d) should have returned %v. Got: %v", key, found, ok)
+				}
+			}
+		}
+		if !isValidBTree(withCompare) {
+			t.Fatalf("BTree of Comparers should be valid")
+		}
+
+		// Should hold the same items as with Less
+		lessIter, compareIter := withLess.NewIterator(), withCompare.NewIterator()
+		for lessIter.HasNext() || compareIter.HasNext() {
+			l, _ := lessIter.Next()
+			c, err := compareIter.Next()
+			if err != nil || l == nil || l.(*countedItem).key != c.(*countedComparer).key {
+				t.Fatalf("Iterators should have returned the same keys. Got: %v and %v", l, c)
+			}
+		}
+
+		// Should compare fewer times than with Less
+		if compareCalls >= lessCalls {
+			t.Errorf("Comparers should have needed fewer comparisons than %d. Got: %d", lessCalls, compareCalls)
+		}
+	}
 }
 
 //=============================================================================
@@ -319,6 +797,63 @@ func benchmarkIteratorReverse(size, order int, b *testing.B) {
 	}
 }
 
+func benchmarkInsert(size, order int, batched bool, b *testing.B) {
+	massItems := uniqueInputsN(size)
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		bt := New(order)
+		if batched {
+			bt.InsertBatch(massItems)
+			continue
+		}
+		for _, item := range massItems {
+			bt.Insert(item)
+		}
+	}
+}
+
+// benchmarkChurn measures deleting and reinserting every item of a tree whose
+// FreeList holds up to freeListSize nodes.
+func benchmarkChurn(size, order, freeListSize int, b *testing.B) {
+	massItems := uniqueInputsN(size)
+	bt, _ := NewWithOptions(Options{Order: order, FreeList: NewFreeList(freeListSize)})
+	bt.InsertBatch(massItems)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		for _, item := range massItems {
+			bt.Delete(item)
+		}
+		for _, item := range massItems {
+			bt.Insert(item)
+		}
+	}
+}
+
+func benchmarkComparisons(size, order int, comparer bool, b *testing.B) {
+	var calls int
+	its := make([]Item, size)
+	for i, k := range rand.Perm(size) {
+		if comparer {
+			its[i] = &countedComparer{k, &calls}
+		} else {
+			its[i] = &countedItem{k, &calls}
+		}
+	}
+	bt := New(order)
+	for _, item := range its {
+		bt.Insert(item)
+	}
+	calls = 0
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		for _, item := range its {
+			bt.Search(item)
+		}
+	}
+	b.ReportMetric(float64(calls)/float64(b.N*size), "cmps/search")
+}
+
 func iterateThrough(iter *Iterator) {
 	for iter.HasNext() {
 		iter.Next()
@@ -337,6 +872,19 @@ func BenchmarkIteratorReverse1000(b *testing.B)   { benchmarkIteratorReverse(100
 func BenchmarkIteratorReverse10000(b *testing.B)  { benchmarkIteratorReverse(10000, 3, b) }
 func BenchmarkIteratorReverse100000(b *testing.B) { benchmarkIteratorReverse(100000, 3, b) }
 
+func BenchmarkInsert1000(b *testing.B)        { benchmarkInsert(1000, 16, false, b) }
+func BenchmarkInsert100000(b *testing.B)      { benchmarkInsert(100000, 16, false, b) }
+func BenchmarkInsertBatch1000(b *testing.B)   { benchmarkInsert(1000, 16, true, b) }
+func BenchmarkInsertBatch100000(b *testing.B) { benchmarkInsert(100000, 16, true, b) }
+
+func BenchmarkChurn10000(b *testing.B)          { benchmarkChurn(10000, 16, 0, b) }
+func BenchmarkChurn10000FreeList(b *testing.B)  { benchmarkChurn(10000, 16, 1024, b) }
+func BenchmarkChurn100000(b *testing.B)         { benchmarkChurn(100000, 16, 0, b) }
+func BenchmarkChurn100000FreeList(b *testing.B) { benchmarkChurn(100000, 16, 16384, b) }
+
+func BenchmarkComparisonsLess(b *testing.B)     { benchmarkComparisons(100000, 16, false, b) }
+func BenchmarkComparisonsComparer(b *testing.B) { benchmarkComparisons(100000, 16, true, b) }
+
 //=============================================================================
 //= Helpers
 //=============================================================================
@@ -357,6 +905,34 @@ func (ti *testItem) String() string {
 	return fmt.Sprintf("(k: %d, v: %d),", ti.key, ti.val)
 }
 
+// A countedItem is a testItem which counts its calls to Less.
+type countedItem struct {
+	key   int
+	calls *int
+}
+
+func (ci *countedItem) Less(other Item) bool {
+	*ci.calls++
+	return ci.key < other.(*countedItem).key
+}
+
+// A countedComparer is like a countedItem, but also implements Comparer.
+// It counts its calls to both Less and Compare.
+type countedComparer struct {
+	key   int
+	calls *int
+}
+
+func (cc *countedComparer) Less(other Item) bool {
+	*cc.calls++
+	return cc.key < other.(*countedComparer).key
+}
+
+func (cc *countedComparer) Compare(other Item) int {
+	*cc.calls++
+	return cmp.Compare(cc.key, other.(*countedComparer).key)
+}
+
 // Return slice of *testItems with key/val between 0 and n.
 // Values will be randomly ordered, as ranging over maps is random.
 func uniqueInputsN(n int) []Item {
@@ -380,6 +956,51 @@ func duplicateInputsN(n int) []Item {
 	return itemSlice
 }
 
+// decodeTestItem is an ItemDecoder for testItems stored as pairs of
+// big-endian int64s.
+func decodeTestItem(r io.Reader) (Item, error) {
+	var kv [2]int64
+	if err := binary.Read(r, binary.BigEndian, &kv); err != nil {
+		return nil, err
+	}
+	return &testItem{key: int(kv[0]), val: int(kv[1])}, nil
+}
+
+// checkLoaded checks that a bulkloaded tree is valid and holds exactly the
+// given items, or that loading failed if shouldFail is set.
+func checkLoaded(t *testing.T, bt *BTree, err error, items []Item, shouldFail bool) {
+	if shouldFail {
+		if err == nil {
+			t.Errorf("Bulkload should have failed\n")
+		}
+		return
+	}
+	if err != nil {
+		t.Fatalf("Bulkload should not have failed: %v\n", err)
+	}
+	if !isValidBTree(bt) {
+		bt.print()
+		t.Fatalf("Bulkloaded tree is not valid\n")
+	}
+	iter := bt.NewIterator()
+	for _, want := range items {
+		got, err := iter.Next()
+		if err != nil || got.Less(want) || want.Less(got) {
+			t.Fatalf("Bulkloaded tree should contain items in order. Want: %v, Got: %v", want, got)
+		}
+	}
+	if iter.HasNext() {
+		t.Fatalf("Bulkloaded tree should not contain extra items")
+	}
+}
+
+// A failingWriter is an io.Writer which always fails.
+type failingWriter struct{}
+
+func (failingWriter) Write(p []byte) (int, error) {
+	return 0, errors.New("write failed")
+}
+
 // atMostChildren recursively checks that very node in a BTree has at most
 // 'order' children (max = tree order).
 func atMostChildren(curr *node, max int) bool {
@@ -0,0 +1,33 @@
+package btree
+
+import (
+	"bytes"
+)
+
+//=============================================================================
+//= Types
+//=============================================================================
+
+// A BytesItem is an Item ordered lexicographically by its bytes.
+//
+// Together with the encodings of package keyenc, it lets a BTree hold
+// composite keys without a hand-written Less method:
+//
+//	key := keyenc.AppendString(nil, user)
+//	key = keyenc.AppendTimeDesc(key, created)
+//	tree.Insert(btree.BytesItem(key))
+type BytesItem []byte
+
+//=============================================================================
+//= Methods
+//=============================================================================
+
+// Less compares two BytesItems lexicographically.
+func (bi BytesItem) Less(other Item) bool {
+	return bytes.Compare(bi, other.(BytesItem)) < 0
+}
+
+// Compare compares two BytesItems lexicographically, as bytes.Compare does.
+func (bi BytesItem) Compare(other Item) int {
+	return bytes.Compare(bi, other.(BytesItem))
+}
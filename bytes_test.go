@@ -0,0 +1,49 @@
+package btree
+
+import (
+	"bytes"
+	"math/rand"
+	"testing"
+)
+
+func TestBytesItem(t *testing.T) {
+	keys := [][]byte{nil, {0}, {0, 0}, {0, 1}, {1}, {1, 0xFF}, {0xFF}, {0xFF, 0}}
+	b := New(3)
+	for _, i := range rand.Perm(len(keys)) {
+		b.Insert(BytesItem(keys[i]))
+	}
+	// Should not insert a duplicate
+	b.Insert(BytesItem{0xFF})
+	if !isValidBTree(b) {
+		t.Fatalf("BTree should be valid")
+	}
+
+	// Should iterate in lexicographic order
+	iter := b.NewIterator()
+	for _, key := range keys {
+		next, err := iter.Next()
+		if err != nil || !bytes.Equal(next.(BytesItem), key) {
+			t.Fatalf("Iterator should have returned %x. Got: %x, error: %v", key, next, err)
+		}
+	}
+	if iter.HasNext() {
+		t.Fatalf("Iterator should no longer have next")
+	}
+
+	// Should compare consistently with Less
+	for _, a := range keys {
+		for _, b := range keys {
+			if want, got := bytes.Compare(a, b), BytesItem(a).Compare(BytesItem(b)); got != want {
+				t.Errorf("Compare(%x, %x) should return %d. Got: %d", a, b, want, got)
+			}
+		}
+	}
+
+	// Should find keys equal in content
+	if _, ok := b.Search(BytesItem([]byte{1, 0xFF})); !ok {
+		t.Errorf("Search should have found key 01ff")
+	}
+	if _, ok := b.Search(BytesItem{1, 0}); ok {
+		t.Errorf("Search should not have found key 0100")
+	}
+}
@@ -0,0 +1,287 @@
+package btree
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+//=============================================================================
+//= Variables and Constants
+//=============================================================================
+
+// Default interval between checks of a Checkpointer's triggers.
+const defaultCheckEvery = time.Second
+
+//=============================================================================
+//= Types
+//=============================================================================
+
+// CheckpointOptions configures a Checkpointer.
+type CheckpointOptions struct {
+	// MaxLogSize triggers a checkpoint once the log reaches this many
+	// bytes. Zero disables the trigger.
+	MaxLogSize int64
+
+	// Interval triggers a checkpoint once this much time has passed since
+	// the last one, provided the log is not empty. Zero disables the
+	// trigger.
+	Interval time.Duration
+
+	// CheckEvery is how often the triggers are checked, defaulting to one
+	// second.
+	CheckEvery time.Duration
+}
+
+// A Checkpointer periodically checkpoints a DurableBTree in the background,
+// so that its log does not grow without bound.
+type Checkpointer struct {
+	tree *DurableBTree
+	opts CheckpointOptions
+	stop chan struct{}
+	done chan struct{}
+
+	stopOnce sync.Once // Closes stop.
+
+	mu   sync.Mutex // Guards err.
+	err  error      // Most recent checkpoint error.
+	last time.Time  // Time of the most recent checkpoint.
+}
+
+//=============================================================================
+//= Methods
+//=============================================================================
+
+// Checkpoint writes a snapshot of the tree to its directory and truncates its
+// log.
+//
+// Writers are only blocked while the tree's items are copied and its log is
+// rotated out; the snapshot is encoded and written afterwards. The snapshot
+// is written to a temporary file which is atomically renamed into place, and
+// the rotated log is only removed once the snapshot is durable, so a crash at
+// any point leaves files from which Recover can rebuild the tree.
+//
+// NOTE: Because replaying an operation which is already reflected in the
+// snapshot has no effect, logs may safely overlap with the snapshot.
+func (d *DurableBTree) Checkpoint() error {
+	d.checkpointMu.Lock()
+	defer d.checkpointMu.Unlock()
+
+	d.mu.Lock()
+	order, codec := d.tree.order, d.wal.codec
+	all := make([]Item, 0)
+	for iter := d.tree.NewIterator(); iter.HasNext(); {
+		item, _ := iter.Next()
+		all = append(all, item)
+	}
+	err := d.rotateLog()
+	d.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	i := 0
+	data, err := marshalBinary(order, codec, func() (Item, bool) {
+		if i == len(all) {
+			return nil, false
+		}
+		i++
+		return all[i-1], true
+	})
+	if err != nil {
+		return err
+	}
+	if err := writeFileAtomic(filepath.Join(d.dir, snapshotFile), data); err != nil {
+		return err
+	}
+	if err := os.Remove(filepath.Join(d.dir, walOldFile)); err != nil {
+		return err
+	}
+	return syncDir(d.dir)
+}
+
+// rotateLog moves the records of the current log to the old log and starts a
+// new, empty log.
+//
+// If rotation fails, the log at the current path is reopened, so that the
+// tree remains writable: either the records were not moved, and are appended
+// to, or they were, and a new log is started after them.
+//
+// NOTE: d.mu must be held.
+func (d *DurableBTree) rotateLog() (err error) {
+	path, oldPath := filepath.Join(d.dir, walFile), filepath.Join(d.dir, walOldFile)
+	codec, opts := d.wal.codec, d.wal.opts
+	defer func() {
+		if err == nil {
+			return
+		}
+		if wal, rerr := OpenWAL(path, codec, opts); rerr == nil {
+			d.wal = wal
+		}
+	}()
+	if err := d.wal.Close(); err != nil {
+		return err
+	}
+
+	_, err = os.Stat(oldPath)
+	switch {
+	case os.IsNotExist(err):
+		err = os.Rename(path, oldPath)
+	case err == nil:
+		// An earlier checkpoint did not finish, so the old log is still
+		// needed. The current log is appended to it instead.
+		err = appendFile(oldPath, path)
+	}
+	if err != nil {
+		return err
+	}
+	if err := syncDir(d.dir); err != nil {
+		return err
+	}
+
+	wal, err := OpenWAL(path, codec, opts)
+	if err != nil {
+		return err
+	}
+	d.wal = wal
+	return nil
+}
+
+// Err returns the error from the most recent background checkpoint, or nil
+// if it succeeded.
+func (c *Checkpointer) Err() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.err
+}
+
+// Stop stops the Checkpointer and waits for any checkpoint in progress to
+// finish. It returns the same error as Err, and may be called more than once.
+func (c *Checkpointer) Stop() error {
+	c.stopOnce.Do(func() { close(c.stop) })
+	<-c.done
+	return c.Err()
+}
+
+// run checks the Checkpointer's triggers until it is stopped.
+func (c *Checkpointer) run() {
+	defer close(c.done)
+	ticker := time.NewTicker(c.opts.CheckEvery)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-c.stop:
+			return
+		case now := <-ticker.C:
+			if !c.due(now) {
+				continue
+			}
+			err := c.tree.Checkpoint()
+			c.mu.Lock()
+			c.err = err
+			c.mu.Unlock()
+			c.last = now
+		}
+	}
+}
+
+// due determines if a checkpoint should be taken.
+func (c *Checkpointer) due(now time.Time) bool {
+	size := c.tree.LogSize()
+	if c.opts.MaxLogSize > 0 && size >= c.opts.MaxLogSize {
+		return true
+	}
+	return c.opts.Interval > 0 && size > 0 && now.Sub(c.last) >= c.opts.Interval
+}
+
+//=============================================================================
+//= Functions
+//=============================================================================
+
+// NewCheckpointer returns a Checkpointer which checkpoints d whenever one of
+// the triggers in opts fires, until it is stopped with Stop.
+func NewCheckpointer(d *DurableBTree, opts CheckpointOptions) *Checkpointer {
+	if opts.CheckEvery <= 0 {
+		opts.CheckEvery = defaultCheckEvery
+	}
+	c := &Checkpointer{
+		tree: d,
+		opts: opts,
+		stop: make(chan struct{}),
+		done: make(chan struct{}),
+		last: time.Now(),
+	}
+	go c.run()
+	return c
+}
+
+// writeFileAtomic durably replaces the file at path with data, by writing it
+// to a temporary file which is then renamed over path.
+func writeFileAtomic(path string, data []byte) error {
+	tmp := path + ".tmp"
+	file, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	_, err = file.Write(data)
+	if err == nil {
+		err = file.Sync()
+	}
+	if cerr := file.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(tmp, path)
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return syncDir(filepath.Dir(path))
+}
+
+// appendFile durably appends the contents of the file at src to the file at
+// dst, and then removes src. If appending fails, dst is truncated back to its
+// original size, so that it does not end with a partial record.
+func appendFile(dst, src string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	info, err := out.Stat()
+	if err == nil {
+		if _, err = io.Copy(out, in); err != nil {
+			out.Truncate(info.Size())
+		}
+	}
+	if err == nil {
+		err = out.Sync()
+	}
+	if cerr := out.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+	return os.Remove(src)
+}
+
+// syncDir commits the entries of a directory to stable storage.
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	err = d.Sync()
+	if cerr := d.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
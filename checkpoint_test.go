@@ -0,0 +1,139 @@
+package btree
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestCheckpoint(t *testing.T) {
+	massItems := uniqueInputsN(300)
+	dir := t.TempDir()
+	d, err := OpenDurable(dir, 4, testItemCodec{}, WALOptions{Sync: SyncNever})
+	if err != nil {
+		t.Fatalf("OpenDurable should not have failed: %v", err)
+	}
+	defer d.Close()
+
+	for _, item := range massItems[:100] {
+		d.Insert(item)
+	}
+	if err := d.Checkpoint(); err != nil {
+		t.Fatalf("Checkpoint should not have failed: %v", err)
+	}
+	if d.LogSize() != 0 {
+		t.Errorf("Checkpoint should have truncated the log. Size: %d", d.LogSize())
+	}
+	if _, err := os.Stat(filepath.Join(dir, walOldFile)); !os.IsNotExist(err) {
+		t.Errorf("Checkpoint should have removed the rotated log")
+	}
+	tree, err := Recover(dir, 4, testItemCodec{})
+	checkLoaded(t, tree, err, massItems[:100], false)
+
+	// Should recover from the snapshot and log together
+	for _, item := range massItems[100:200] {
+		d.Insert(item)
+	}
+	tree, err = Recover(dir, 4, testItemCodec{})
+	checkLoaded(t, tree, err, massItems[:200], false)
+
+	// Should recover after a checkpoint is interrupted after rotating the
+	// log, including when a later checkpoint is also interrupted
+	for i := 0; i < 2; i++ {
+		d.mu.Lock()
+		d.rotateLog()
+		d.mu.Unlock()
+		for _, item := range massItems[200+50*i : 250+50*i] {
+			d.Insert(item)
+		}
+		tree, err = Recover(dir, 4, testItemCodec{})
+		checkLoaded(t, tree, err, massItems[:250+50*i], false)
+	}
+
+	// Should clean up after interrupted checkpoints
+	for _, item := range massItems[:150] {
+		d.Delete(item)
+	}
+	if err := d.Checkpoint(); err != nil {
+		t.Fatalf("Checkpoint should not have failed: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, walOldFile)); !os.IsNotExist(err) {
+		t.Errorf("Checkpoint should have removed the rotated log")
+	}
+	tree, err = Recover(dir, 4, testItemCodec{})
+	checkLoaded(t, tree, err, massItems[150:], false)
+}
+
+func TestCheckpointFailure(t *testing.T) {
+	massItems := uniqueInputsN(100)
+	dir := t.TempDir()
+	d, err := OpenDurable(dir, 4, testItemCodec{}, WALOptions{Sync: SyncNever})
+	if err != nil {
+		t.Fatalf("OpenDurable should not have failed: %v", err)
+	}
+	defer d.Close()
+	for _, item := range massItems[:50] {
+		d.Insert(item)
+	}
+
+	// A directory in place of the old log makes rotating the log fail.
+	oldPath := filepath.Join(dir, walOldFile)
+	os.Mkdir(oldPath, 0755)
+	if err := d.Checkpoint(); err == nil {
+		t.Fatalf("Checkpoint should have failed")
+	}
+
+	// Should keep the log open for writing
+	for _, item := range massItems[50:] {
+		if err := d.Insert(item); err != nil {
+			t.Fatalf("Insert should not have failed after a failed checkpoint: %v", err)
+		}
+	}
+	os.Remove(oldPath)
+	tree, err := Recover(dir, 4, testItemCodec{})
+	checkLoaded(t, tree, err, massItems, false)
+}
+
+func TestCheckpointer(t *testing.T) {
+	cases := []struct {
+		opts CheckpointOptions
+	}{
+		// Should checkpoint when the log grows too large
+		{opts: CheckpointOptions{MaxLogSize: 500, CheckEvery: time.Millisecond}},
+		// Should checkpoint periodically
+		{opts: CheckpointOptions{Interval: 5 * time.Millisecond, CheckEvery: time.Millisecond}},
+	}
+
+	for _, c := range cases {
+		dir := t.TempDir()
+		d, err := OpenDurable(dir, 4, testItemCodec{}, WALOptions{Sync: SyncNever})
+		if err != nil {
+			t.Fatalf("OpenDurable should not have failed: %v", err)
+		}
+		cp := NewCheckpointer(d, c.opts)
+
+		massItems := uniqueInputsN(100)
+		for _, item := range massItems {
+			d.Insert(item)
+		}
+		deadline := time.Now().Add(5 * time.Second)
+		for d.LogSize() > c.opts.MaxLogSize && time.Now().Before(deadline) {
+			time.Sleep(time.Millisecond)
+		}
+		if err := cp.Stop(); err != nil {
+			t.Fatalf("Checkpointer should not have failed: %v", err)
+		}
+		// Should allow stopping more than once
+		if err := cp.Stop(); err != nil {
+			t.Errorf("Second Stop should not have failed: %v", err)
+		}
+		if size := d.LogSize(); size > c.opts.MaxLogSize {
+			t.Errorf("Checkpointer should have truncated the log. Size: %d", size)
+		}
+		d.Close()
+
+		tree, err := Recover(dir, 4, testItemCodec{})
+		checkLoaded(t, tree, err, massItems, false)
+	}
+}
@@ -0,0 +1,308 @@
+package btree
+
+//=============================================================================
+//= Types
+//=============================================================================
+
+// A cowNode is a node of a persistent, copy-on-write B-Tree.
+//
+// Once a cowNode is reachable from a published root it is never modified.
+// Changes copy the nodes along the path from the root to the change, so every
+// earlier root remains a valid, unchanging version of the tree.
+type cowNode struct {
+	items    items
+	children []*cowNode
+}
+
+// A cowIterator is a stateful iterator over a persistent B-Tree.
+type cowIterator struct {
+	dir   int
+	stack []cowFrame // Path from the root to the next item.
+}
+
+// A cowFrame is a node on a cowIterator's path, with the index of the next
+// item to return from it.
+type cowFrame struct {
+	n *cowNode
+	i int
+}
+
+//=============================================================================
+//= Methods
+//=============================================================================
+
+// search searches the subtree rooted at n for an item.
+func (n *cowNode) search(item Item) (Item, bool) {
+	for n != nil {
+		i, found := n.items.findMatch(item)
+		if found {
+			return n.items[i-1], true
+		} else if len(n.children) == 0 {
+			break
+		}
+		n = n.children[i]
+	}
+	return nil, false
+}
+
+// insert returns a copy of the subtree rooted at n which also holds item,
+// and whether the item was inserted. If the item is already in the subtree,
+// n itself is returned.
+//
+// If the copy overflows, it is split: the copy holds the left half, and the
+// median item and right half are returned for the caller to add to the
+// parent.
+func (n *cowNode) insert(order int, item Item) (*cowNode, Item, *cowNode, bool) {
+	i, found := n.items.findMatch(item)
+	if found {
+		return n, nil, nil, false
+	}
+	c := n.clone()
+	if len(n.children) == 0 {
+		c.items.insertAt(i, item)
+	} else {
+		child, median, right, ok := n.children[i].insert(order, item)
+		if !ok {
+			return n, nil, nil, false
+		}
+		c.children[i] = child
+		if right != nil {
+			c.items.insertAt(i, median)
+			c.children = append(c.children, nil)
+			copy(c.children[i+2:], c.children[i+1:])
+			c.children[i+1] = right
+		}
+	}
+	if len(c.items) < order {
+		return c, nil, nil, true
+	}
+
+	mid := len(c.items) / 2
+	median := c.items[mid]
+	right := &cowNode{items: append(items(nil), c.items[mid+1:]...)}
+	c.items = c.items[:mid:mid]
+	if len(c.children) > 0 {
+		right.children = append([]*cowNode(nil), c.children[mid+1:]...)
+		c.children = c.children[: mid+1 : mid+1]
+	}
+	return c, median, right, true
+}
+
+// delete returns a copy of the subtree rooted at n without item, and whether
+// the item was deleted. If the item is not in the subtree, n itself is
+// returned.
+//
+// The copy may be left with fewer than minItems items, in which case the
+// caller must rebalance it.
+func (n *cowNode) delete(minItems int, item Item) (*cowNode, bool) {
+	i, found := n.items.findMatch(item)
+	if len(n.children) == 0 {
+		if !found {
+			return n, false
+		}
+		c := n.clone()
+		c.items.delete(i - 1)
+		return c, true
+	}
+
+	// An item in an internal node is replaced with the maximum item of its
+	// left subtree, which is deleted from the subtree instead.
+	if found {
+		child, max := n.children[i-1].deleteMax(minItems)
+		c := n.clone()
+		c.items[i-1] = max
+		c.children[i-1] = child
+		c.rebalance(minItems, i-1)
+		return c, true
+	}
+	child, ok := n.children[i].delete(minItems, item)
+	if !ok {
+		return n, false
+	}
+	c := n.clone()
+	c.children[i] = child
+	c.rebalance(minItems, i)
+	return c, true
+}
+
+// deleteMax returns a copy of the subtree rooted at n without its maximum
+// item, and that item.
+func (n *cowNode) deleteMax(minItems int) (*cowNode, Item) {
+	c := n.clone()
+	if len(n.children) == 0 {
+		max := c.items[len(c.items)-1]
+		c.items.delete(len(c.items) - 1)
+		return c, max
+	}
+	last := len(n.children) - 1
+	child, max := n.children[last].deleteMax(minItems)
+	c.children[last] = child
+	c.rebalance(minItems, last)
+	return c, max
+}
+
+// rebalance ensures that the i-th child of c holds at least minItems items,
+// by borrowing an item from a sibling or merging it with one.
+//
+// NOTE: c and its i-th child must be unpublished copies. Siblings are copied
+// before they are modified.
+func (c *cowNode) rebalance(minItems, i int) {
+	child := c.children[i]
+	if len(child.items) >= minItems {
+		return
+	}
+	leaf := len(child.children) == 0
+
+	// 1. Borrow from the left sibling, through the separator.
+	if i > 0 && len(c.children[i-1].items) > minItems {
+		left := c.children[i-1].clone()
+		child.items.insertAt(0, c.items[i-1])
+		c.items[i-1] = left.items[len(left.items)-1]
+		left.items.delete(len(left.items) - 1)
+		if !leaf {
+			last := left.children[len(left.children)-1]
+			left.children = left.children[:len(left.children)-1]
+			child.children = append([]*cowNode{last}, child.children...)
+		}
+		c.children[i-1] = left
+		return
+	}
+
+	// 2. Borrow from the right sibling, through the separator.
+	if i < len(c.children)-1 && len(c.children[i+1].items) > minItems {
+		right := c.children[i+1].clone()
+		child.items = append(child.items, c.items[i])
+		c.items[i] = right.items[0]
+		right.items.delete(0)
+		if !leaf {
+			child.children = append(child.children, right.children[0])
+			right.children = right.children[1:]
+		}
+		c.children[i+1] = right
+		return
+	}
+
+	// 3. Merge with a sibling and the separator between them.
+	if i > 0 {
+		i--
+	}
+	left, right := c.children[i], c.children[i+1]
+	merged := &cowNode{items: make(items, 0, len(left.items)+1+len(right.items))}
+	merged.items = append(merged.items, left.items...)
+	merged.items = append(merged.items, c.items[i])
+	merged.items = append(merged.items, right.items...)
+	if !leaf {
+		merged.children = append(append(merged.children, left.children...), right.children...)
+	}
+	c.items.delete(i)
+	c.children[i] = merged
+	copy(c.children[i+1:], c.children[i+2:])
+	c.children[len(c.children)-1] = nil
+	c.children = c.children[:len(c.children)-1]
+}
+
+// clone returns a copy of n which can be modified.
+func (n *cowNode) clone() *cowNode {
+	c := &cowNode{items: make(items, len(n.items), len(n.items)+1)}
+	copy(c.items, n.items)
+	if len(n.children) > 0 {
+		c.children = make([]*cowNode, len(n.children), len(n.children)+1)
+		copy(c.children, n.children)
+	}
+	return c
+}
+
+// hasNext determines if iterator can iterate.
+func (ci *cowIterator) hasNext() bool {
+	return len(ci.stack) > 0
+}
+
+// next moves the iterator forward and returns its previous value.
+func (ci *cowIterator) next() Item {
+	top := &ci.stack[len(ci.stack)-1]
+	item := top.n.items[top.i]
+	top.i += ci.dir
+	if len(top.n.children) > 0 {
+		// The next item is at the edge of the subtree beside item.
+		child := top.i
+		if ci.dir == reverse {
+			child++
+		}
+		ci.descend(top.n.children[child])
+	}
+	ci.trim()
+	return item
+}
+
+// descend pushes the path from n to the first item of its subtree in the
+// iterator's direction.
+func (ci *cowIterator) descend(n *cowNode) {
+	for n != nil {
+		i := 0
+		if ci.dir == reverse {
+			i = len(n.items) - 1
+		}
+		ci.stack = append(ci.stack, cowFrame{n: n, i: i})
+		if len(n.children) == 0 {
+			break
+		}
+		if ci.dir == reverse {
+			n = n.children[len(n.children)-1]
+		} else {
+			n = n.children[0]
+		}
+	}
+}
+
+// trim pops the nodes with no items left to return.
+func (ci *cowIterator) trim() {
+	for len(ci.stack) > 0 {
+		top := ci.stack[len(ci.stack)-1]
+		if 0 <= top.i && top.i < len(top.n.items) {
+			return
+		}
+		ci.stack = ci.stack[:len(ci.stack)-1]
+	}
+}
+
+//=============================================================================
+//= Functions
+//=============================================================================
+
+// cowInsert returns the root of a copy of the tree rooted at root which also
+// holds item, and whether the item was inserted.
+func cowInsert(root *cowNode, order int, item Item) (*cowNode, bool) {
+	if root == nil {
+		return &cowNode{items: items{item}}, true
+	}
+	c, median, right, ok := root.insert(order, item)
+	if right != nil {
+		c = &cowNode{items: items{median}, children: []*cowNode{c, right}}
+	}
+	return c, ok
+}
+
+// cowDelete returns the root of a copy of the tree rooted at root without
+// item, and whether the item was deleted.
+func cowDelete(root *cowNode, order int, item Item) (*cowNode, bool) {
+	if root == nil {
+		return nil, false
+	}
+	c, ok := root.delete((order+1)/2-1, item)
+	if len(c.items) == 0 {
+		if len(c.children) == 0 {
+			return nil, ok
+		}
+		c = c.children[0]
+	}
+	return c, ok
+}
+
+// newCowIterator returns an iterator over the tree rooted at root, which
+// moves in direction dir.
+func newCowIterator(root *cowNode, dir int) *cowIterator {
+	ci := &cowIterator{dir: dir}
+	ci.descend(root)
+	ci.trim()
+	return ci
+}
@@ -0,0 +1,817 @@
+package btree
+
+import (
+	"container/list"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"math"
+	"os"
+)
+
+//=============================================================================
+//= Variables and Constants
+//=============================================================================
+
+// Disk file format identifiers.
+const (
+	diskMagic   = "BTDK"
+	diskVersion = 1
+)
+
+// Defaults for DiskOptions.
+const (
+	defaultPageSize = 4096
+	defaultPoolSize = 64
+)
+
+// Page kinds, stored in the first byte of every node page.
+const (
+	leafPage     = 1
+	internalPage = 2
+	freePage     = 3
+)
+
+// Sizes of the fixed parts of pages.
+const (
+	metaSize       = 4 + 1 + 4 + 4 + 8 + 8 + 8 + 8 + 4
+	nodeHeaderSize = 1 + 2
+)
+
+// metaPage is the ID of the page holding the file's metadata.
+// Because page 0 can never be a node, it doubles as the nil page ID.
+const metaPage pageID = 0
+
+//=============================================================================
+//= Types
+//=============================================================================
+
+// A DiskBTree is a B-Tree whose nodes are stored as fixed-size pages in a
+// file.
+//
+// Child pointers are replaced by page IDs, and recently used pages are cached
+// in a buffer pool of decoded nodes. Changes are written back to the file
+// when pages are evicted from the pool, and by Flush, Sync and Close.
+//
+// NOTE: A DiskBTree is not safe for concurrent use, and must not be modified
+// while it is being iterated.
+type DiskBTree struct {
+	file     *os.File
+	codec    ItemCodec
+	order    int // Maximum number of children each node can have.
+	pageSize int
+	maxItem  int // Maximum encoded size of a single item.
+
+	root     pageID // Page of the root node.
+	numPages uint64 // Number of pages in the file, including the meta page.
+	freeHead pageID // First page of the free list, or metaPage if empty.
+	count    int    // Number of items in the tree.
+
+	pool *bufferPool
+}
+
+// DiskOptions configures OpenDisk.
+type DiskOptions struct {
+	// Codec encodes items to and from pages. It is required.
+	Codec ItemCodec
+
+	// Order is the order of a newly created tree. When opening an
+	// existing file, it must either be zero or match the file's order.
+	Order int
+
+	// PageSize is the size in bytes of each page of a newly created file,
+	// defaulting to 4096. When opening an existing file, it must either be
+	// zero or match the file's page size.
+	PageSize int
+
+	// PoolSize is the number of pages cached in memory, defaulting to 64.
+	PoolSize int
+}
+
+// A DiskIterator is a stateful iterator for DiskBTrees.
+//
+// DiskIterators move either in-order or reverse in-order.
+type DiskIterator struct {
+	tree  *DiskBTree
+	dir   int
+	stack []diskFrame
+	err   error // Error to be returned by the next call to Next.
+}
+
+// A diskFrame is a node on the path to a DiskIterator's position.
+type diskFrame struct {
+	id    pageID
+	index int // Index of the next item to visit in the node.
+	size  int // Number of items in the node.
+}
+
+// A diskPath is the path from the root to a node, recording which child was
+// followed from each node along the way.
+type diskPath []diskStep
+
+type diskStep struct {
+	node  *diskNode
+	index int
+}
+
+type pageID uint64
+
+type pageIDs []pageID
+
+type diskNode struct {
+	id       pageID
+	items    items
+	children pageIDs
+	dirty    bool // Whether the node has changed since it was last written.
+}
+
+// A bufferPool caches decoded nodes, evicting the least recently used.
+type bufferPool struct {
+	capacity int
+	lru      *list.List // Values are *diskNode, most recently used first.
+	pages    map[pageID]*list.Element
+}
+
+//=============================================================================
+//= Methods
+//=============================================================================
+
+// Insert inserts a new item into the DiskBTree. If needed, it also rebalances
+// the tree.
+//
+// Duplicate values cannot be inserted. If the item to insert is found in the
+// tree, the method will fail silently.
+func (d *DiskBTree) Insert(item Item) error {
+	return d.finish(d.insert(item))
+}
+
+// Delete deletes an item from the DiskBTree. If needed, it also rebalances
+// the tree.
+//
+// If the item to delete does not exist in the tree, the method will fail
+// silently.
+func (d *DiskBTree) Delete(item Item) error {
+	return d.finish(d.delete(item))
+}
+
+// Search searches for an item in the DiskBTree.
+//
+// If the item is found, the method returns the stored item.
+// Otherwise, the function returns nil and ErrNotFound, or an error reading
+// the file.
+func (d *DiskBTree) Search(item Item) (Item, error) {
+	n, _, found, err := d.find(item)
+	if err = d.finish(err); err != nil {
+		return nil, err
+	} else if !found {
+		return nil, ErrNotFound
+	}
+	return n.items[n.items.find(item)-1], nil
+}
+
+// Len returns the number of items in the DiskBTree.
+func (d *DiskBTree) Len() int {
+	return d.count
+}
+
+// NewIterator returns a new iterator for the DiskBTree.
+func (d *DiskBTree) NewIterator() *DiskIterator {
+	di := &DiskIterator{tree: d, dir: forward}
+	di.err = d.finish(di.descend(d.root))
+	return di
+}
+
+// NewReverseIterator returns a new reverse iterator for the DiskBTree.
+func (d *DiskBTree) NewReverseIterator() *DiskIterator {
+	di := &DiskIterator{tree: d, dir: reverse}
+	di.err = d.finish(di.descend(d.root))
+	return di
+}
+
+// Flush writes all modified pages and the file's metadata to the file.
+func (d *DiskBTree) Flush() error {
+	for e := d.pool.lru.Front(); e != nil; e = e.Next() {
+		if err := d.writeNode(e.Value.(*diskNode)); err != nil {
+			return err
+		}
+	}
+	return d.writeMeta()
+}
+
+// Sync flushes the DiskBTree and commits the file to stable storage.
+func (d *DiskBTree) Sync() error {
+	if err := d.Flush(); err != nil {
+		return err
+	}
+	return d.file.Sync()
+}
+
+// Close syncs the DiskBTree and closes its file.
+func (d *DiskBTree) Close() error {
+	err := d.Sync()
+	if cerr := d.file.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// insert inserts an item into the tree, splitting nodes as needed.
+func (d *DiskBTree) insert(item Item) error {
+	data, err := d.codec.MarshalItem(item)
+	if err != nil {
+		return err
+	}
+	if len(data) > d.maxItem {
+		return fmt.Errorf("encoded item is %d bytes, larger than the maximum of %d for this page size and order", len(data), d.maxItem)
+	}
+
+	n, path, found, err := d.find(item)
+	if err != nil || found {
+		return err
+	}
+
+	n.items.insert(item)
+	n.dirty = true
+	d.count++
+	for len(n.items) >= d.order {
+		mid := len(n.items) / 2
+		midItem := n.items[mid]
+		right, err := d.allocNode()
+		if err != nil {
+			return err
+		}
+		right.items = append(right.items, n.items[mid+1:]...)
+		n.items.truncate(mid)
+		if len(n.children) > 0 {
+			right.children = append(right.children, n.children[mid+1:]...)
+			n.children = n.children[:mid+1]
+		}
+
+		if len(path) == 0 {
+			root, err := d.allocNode()
+			if err != nil {
+				return err
+			}
+			root.items = items{midItem}
+			root.children = pageIDs{n.id, right.id}
+			d.root = root.id
+			return nil
+		}
+
+		parent, i := path.pop()
+		parent.items.insert(midItem)
+		parent.children.insert(i+1, right.id)
+		parent.dirty = true
+		n = parent
+	}
+	return nil
+}
+
+// delete deletes an item from the tree, rebalancing nodes as needed.
+func (d *DiskBTree) delete(item Item) error {
+	n, path, found, err := d.find(item)
+	if err != nil || !found {
+		return err
+	}
+
+	// 1. Delete the item from its container node.
+	// As with BTree, an item in an internal node is replaced with the
+	// maximum item of its left subtree, which is then deleted from its
+	// leaf instead.
+	i := n.items.find(item) - 1
+	if len(n.children) == 0 {
+		n.items.delete(i)
+	} else {
+		path = append(path, diskStep{n, i})
+		leaf, err := d.node(n.children[i])
+		if err != nil {
+			return err
+		}
+		for len(leaf.children) > 0 {
+			path = append(path, diskStep{leaf, len(leaf.children) - 1})
+			if leaf, err = d.node(leaf.children[len(leaf.children)-1]); err != nil {
+				return err
+			}
+		}
+		n.items[i] = leaf.items[len(leaf.items)-1]
+		n.dirty = true
+		leaf.items.delete(len(leaf.items) - 1)
+		n = leaf
+	}
+	n.dirty = true
+	d.count--
+
+	// 2. Rebalance the tree from the affected leaf upwards.
+	minItems := int(math.Ceil(float64(d.order)/2.0)) - 1
+	for len(path) > 0 && len(n.items) < minItems {
+		parent, i := path.pop()
+		var left, right *diskNode
+		if i > 0 {
+			if left, err = d.node(parent.children[i-1]); err != nil {
+				return err
+			}
+		}
+		if i < len(parent.children)-1 {
+			if right, err = d.node(parent.children[i+1]); err != nil {
+				return err
+			}
+		}
+
+		switch {
+		case right != nil && len(right.items) > minItems:
+			// Left rotation
+			n.items = append(n.items, parent.items[i])
+			parent.items[i] = right.items[0]
+			right.items.delete(0)
+			if len(right.children) > 0 {
+				n.children = append(n.children, right.children[0])
+				right.children.delete(0)
+			}
+			n.dirty, parent.dirty, right.dirty = true, true, true
+			return nil
+		case left != nil && len(left.items) > minItems:
+			// Right rotation
+			n.items.insertAt(0, parent.items[i-1])
+			parent.items[i-1] = left.items[len(left.items)-1]
+			left.items.delete(len(left.items) - 1)
+			if len(left.children) > 0 {
+				n.children.insert(0, left.children[len(left.children)-1])
+				left.children.delete(len(left.children) - 1)
+			}
+			n.dirty, parent.dirty, left.dirty = true, true, true
+			return nil
+		case left != nil:
+			if err := d.merge(parent, i-1, left, n); err != nil {
+				return err
+			}
+		default:
+			if err := d.merge(parent, i, n, right); err != nil {
+				return err
+			}
+		}
+		n = parent
+	}
+
+	// The root is replaced by its only child once it runs out of items.
+	if n.id == d.root && len(n.items) == 0 && len(n.children) > 0 {
+		d.root = n.children[0]
+		return d.freeNode(n)
+	}
+	return nil
+}
+
+// find searches for an item, returning the node in which it was found or, if
+// it was not found, the leaf in which it belongs. It also returns the path
+// from the root to that node.
+func (d *DiskBTree) find(item Item) (*diskNode, diskPath, bool, error) {
+	var path diskPath
+	n, err := d.node(d.root)
+	for err == nil {
+		i, found := n.items.findMatch(item)
+		if found {
+			return n, path, true, nil
+		} else if len(n.children) == 0 {
+			return n, path, false, nil
+		}
+		path = append(path, diskStep{n, i})
+		n, err = d.node(n.children[i])
+	}
+	return nil, nil, false, err
+}
+
+// merge merges left, the separator at index sep of parent, and right into
+// left, in that order. The right node's page is then freed.
+func (d *DiskBTree) merge(parent *diskNode, sep int, left, right *diskNode) error {
+	left.items = append(left.items, parent.items[sep])
+	left.items = append(left.items, right.items...)
+	left.children = append(left.children, right.children...)
+	parent.items.delete(sep)
+	parent.children.delete(sep + 1)
+	left.dirty, parent.dirty = true, true
+	return d.freeNode(right)
+}
+
+// node returns the node stored in a page, reading it into the buffer pool if
+// needed.
+func (d *DiskBTree) node(id pageID) (*diskNode, error) {
+	if n := d.pool.get(id); n != nil {
+		return n, nil
+	}
+	n, err := d.readNode(id)
+	if err != nil {
+		return nil, err
+	}
+	d.pool.add(n)
+	return n, nil
+}
+
+// allocNode returns a new empty node, reusing a free page if possible.
+func (d *DiskBTree) allocNode() (*diskNode, error) {
+	id := d.freeHead
+	if id == metaPage {
+		id = pageID(d.numPages)
+		d.numPages++
+	} else {
+		page := make([]byte, nodeHeaderSize+8)
+		if _, err := d.file.ReadAt(page, d.offset(id)); err != nil {
+			return nil, err
+		}
+		if page[0] != freePage {
+			return nil, fmt.Errorf("page %d on free list is not free", id)
+		}
+		d.freeHead = pageID(binary.BigEndian.Uint64(page[1:]))
+	}
+	n := &diskNode{id: id, dirty: true}
+	d.pool.add(n)
+	return n, nil
+}
+
+// freeNode removes a node from the tree and adds its page to the free list.
+func (d *DiskBTree) freeNode(n *diskNode) error {
+	d.pool.remove(n.id)
+	page := make([]byte, d.pageSize)
+	page[0] = freePage
+	binary.BigEndian.PutUint64(page[1:], uint64(d.freeHead))
+	if _, err := d.file.WriteAt(page, d.offset(n.id)); err != nil {
+		return err
+	}
+	d.freeHead = n.id
+	return nil
+}
+
+// finish ends an operation on the tree by trimming the buffer pool. It
+// returns the operation's error, if any, or else any error from trimming.
+func (d *DiskBTree) finish(err error) error {
+	if terr := d.trim(); err == nil {
+		err = terr
+	}
+	return err
+}
+
+// trim evicts nodes from the buffer pool until it is within capacity,
+// writing any modified nodes back to the file.
+//
+// NOTE: Nodes are only evicted between operations, so that nodes held by an
+// operation in progress are never evicted while they are being modified.
+func (d *DiskBTree) trim() error {
+	for d.pool.lru.Len() > d.pool.capacity {
+		n := d.pool.lru.Back().Value.(*diskNode)
+		if err := d.writeNode(n); err != nil {
+			return err
+		}
+		d.pool.remove(n.id)
+	}
+	return nil
+}
+
+// readNode reads and decodes the node stored in a page.
+func (d *DiskBTree) readNode(id pageID) (*diskNode, error) {
+	if id == metaPage || uint64(id) >= d.numPages {
+		return nil, fmt.Errorf("page %d is out of range", id)
+	}
+	page := make([]byte, d.pageSize)
+	if _, err := d.file.ReadAt(page, d.offset(id)); err != nil {
+		return nil, err
+	}
+	kind := page[0]
+	if kind != leafPage && kind != internalPage {
+		return nil, fmt.Errorf("page %d does not hold a node", id)
+	}
+
+	size := int(binary.BigEndian.Uint16(page[1:]))
+	n := &diskNode{id: id, items: make(items, 0, size)}
+	pos := nodeHeaderSize
+	if kind == internalPage {
+		if pos+8*(size+1) > len(page) {
+			return nil, fmt.Errorf("page %d is corrupt", id)
+		}
+		n.children = make(pageIDs, size+1)
+		for i := range n.children {
+			n.children[i] = pageID(binary.BigEndian.Uint64(page[pos:]))
+			pos += 8
+		}
+	}
+	for i := 0; i < size; i++ {
+		itemLen, w := binary.Uvarint(page[pos:])
+		if w <= 0 || uint64(len(page)-pos-w) < itemLen {
+			return nil, fmt.Errorf("page %d is corrupt", id)
+		}
+		pos += w
+		item, err := d.codec.UnmarshalItem(page[pos : pos+int(itemLen)])
+		if err != nil {
+			return nil, err
+		}
+		n.items = append(n.items, item)
+		pos += int(itemLen)
+	}
+	return n, nil
+}
+
+// writeNode encodes and writes a node to its page if it has been modified.
+func (d *DiskBTree) writeNode(n *diskNode) error {
+	if !n.dirty {
+		return nil
+	}
+	page := make([]byte, nodeHeaderSize, d.pageSize)
+	page[0] = leafPage
+	if len(n.children) > 0 {
+		page[0] = internalPage
+	}
+	binary.BigEndian.PutUint16(page[1:], uint16(len(n.items)))
+	for _, c := range n.children {
+		page = binary.BigEndian.AppendUint64(page, uint64(c))
+	}
+	for _, item := range n.items {
+		data, err := d.codec.MarshalItem(item)
+		if err != nil {
+			return err
+		}
+		page = binary.AppendUvarint(page, uint64(len(data)))
+		page = append(page, data...)
+	}
+	if len(page) > d.pageSize {
+		return fmt.Errorf("node does not fit in page %d", n.id)
+	}
+
+	page = page[:d.pageSize]
+	if _, err := d.file.WriteAt(page, d.offset(n.id)); err != nil {
+		return err
+	}
+	n.dirty = false
+	return nil
+}
+
+// writeMeta writes the file's metadata to the meta page.
+func (d *DiskBTree) writeMeta() error {
+	meta := make([]byte, 0, metaSize)
+	meta = append(meta, diskMagic...)
+	meta = append(meta, diskVersion)
+	meta = binary.BigEndian.AppendUint32(meta, uint32(d.pageSize))
+	meta = binary.BigEndian.AppendUint32(meta, uint32(d.order))
+	meta = binary.BigEndian.AppendUint64(meta, uint64(d.root))
+	meta = binary.BigEndian.AppendUint64(meta, d.numPages)
+	meta = binary.BigEndian.AppendUint64(meta, uint64(d.freeHead))
+	meta = binary.BigEndian.AppendUint64(meta, uint64(d.count))
+	meta = binary.BigEndian.AppendUint32(meta, crc32.ChecksumIEEE(meta))
+	_, err := d.file.WriteAt(meta, 0)
+	return err
+}
+
+// readMeta reads the file's metadata from the meta page.
+func (d *DiskBTree) readMeta() error {
+	meta := make([]byte, metaSize)
+	if _, err := d.file.ReadAt(meta, 0); err != nil {
+		return fmt.Errorf("reading DiskBTree metadata: %v", err)
+	}
+	sumPos := metaSize - crc32.Size
+	if string(meta[:len(diskMagic)]) != diskMagic ||
+		crc32.ChecksumIEEE(meta[:sumPos]) != binary.BigEndian.Uint32(meta[sumPos:]) {
+		return errors.New("file is not a DiskBTree or its metadata is corrupt")
+	}
+	if v := meta[len(diskMagic)]; v != diskVersion {
+		return fmt.Errorf("unsupported DiskBTree version %d", v)
+	}
+	pos := len(diskMagic) + 1
+	d.pageSize = int(binary.BigEndian.Uint32(meta[pos:]))
+	d.order = int(binary.BigEndian.Uint32(meta[pos+4:]))
+	d.root = pageID(binary.BigEndian.Uint64(meta[pos+8:]))
+	d.numPages = binary.BigEndian.Uint64(meta[pos+16:])
+	d.freeHead = pageID(binary.BigEndian.Uint64(meta[pos+24:]))
+	d.count = int(binary.BigEndian.Uint64(meta[pos+32:]))
+	return nil
+}
+
+// offset returns the offset of a page in the file.
+func (d *DiskBTree) offset(id pageID) int64 {
+	return int64(id) * int64(d.pageSize)
+}
+
+// create initializes a new file for a DiskBTree.
+func (d *DiskBTree) create(opts DiskOptions) error {
+	d.order, d.pageSize = opts.Order, opts.PageSize
+	if d.pageSize == 0 {
+		d.pageSize = defaultPageSize
+	}
+	if d.order < 3 {
+		return ErrInvalidOrder
+	}
+	if err := d.setMaxItem(); err != nil {
+		return err
+	}
+
+	d.numPages = 1
+	root, err := d.allocNode()
+	if err != nil {
+		return err
+	}
+	d.root = root.id
+	return d.Sync()
+}
+
+// open loads an existing file for a DiskBTree.
+func (d *DiskBTree) open(opts DiskOptions) error {
+	if err := d.readMeta(); err != nil {
+		return err
+	}
+	if opts.Order != 0 && opts.Order != d.order {
+		return fmt.Errorf("DiskBTree has order %d, not %d", d.order, opts.Order)
+	}
+	if opts.PageSize != 0 && opts.PageSize != d.pageSize {
+		return fmt.Errorf("DiskBTree has page size %d, not %d", d.pageSize, opts.PageSize)
+	}
+	return d.setMaxItem()
+}
+
+// setMaxItem computes the largest encoded item which can be inserted while
+// guaranteeing that every node fits in a page.
+func (d *DiskBTree) setMaxItem() error {
+	if d.pageSize < metaSize {
+		return fmt.Errorf("DiskBTree page size must be at least %d", metaSize)
+	}
+	// A full internal node holds order-1 items and order child IDs, and
+	// each item is prefixed with its length.
+	perItem := (d.pageSize - nodeHeaderSize - 8*d.order) / (d.order - 1)
+	d.maxItem = perItem - uvarintLen(uint64(perItem))
+	if d.maxItem < 1 {
+		return fmt.Errorf("DiskBTree page size %d is too small for order %d", d.pageSize, d.order)
+	}
+	return nil
+}
+
+// HasNext determines if iterator can iterate.
+func (di *DiskIterator) HasNext() bool {
+	return di.err != nil || len(di.stack) > 0
+}
+
+// Next moves the iterator forward and returns its previous value.
+//
+// If a page cannot be read, Next returns the error and the iterator stops.
+func (di *DiskIterator) Next() (Item, error) {
+	if di.err != nil {
+		err := di.err
+		di.err, di.stack = nil, nil
+		return nil, err
+	}
+	if !di.HasNext() {
+		return nil, ErrIteratorExhausted
+	}
+
+	top := &di.stack[len(di.stack)-1]
+	n, err := di.tree.node(top.id)
+	if err != nil {
+		di.stack = nil
+		return nil, di.tree.finish(err)
+	}
+	next := n.items[top.index]
+	// The subtree between this item and the next one is visited before
+	// the next item itself.
+	child := top.index
+	if di.dir == forward {
+		child++
+	}
+	top.index += di.dir
+	if len(n.children) > 0 {
+		err = di.descend(n.children[child])
+	} else {
+		di.pop()
+	}
+	if err = di.tree.finish(err); err != nil {
+		di.stack = nil
+		return nil, err
+	}
+	return next, nil
+}
+
+// descend pushes the path from a node to the first leaf visited in its
+// subtree onto the iterator's stack.
+func (di *DiskIterator) descend(id pageID) error {
+	for {
+		n, err := di.tree.node(id)
+		if err != nil {
+			return err
+		}
+		index, child := 0, 0
+		if di.dir == reverse {
+			index, child = len(n.items)-1, len(n.children)-1
+		}
+		di.stack = append(di.stack, diskFrame{id: id, index: index, size: len(n.items)})
+		if len(n.children) == 0 {
+			di.pop()
+			return nil
+		}
+		id = n.children[child]
+	}
+}
+
+// pop removes every node with no items left to visit from the top of the
+// iterator's stack.
+func (di *DiskIterator) pop() {
+	for len(di.stack) > 0 {
+		top := di.stack[len(di.stack)-1]
+		if 0 <= top.index && top.index < top.size {
+			return
+		}
+		di.stack = di.stack[:len(di.stack)-1]
+	}
+}
+
+// pop removes the last step from the path, returning its node and the index
+// of the child which was followed.
+func (p *diskPath) pop() (*diskNode, int) {
+	last := (*p)[len(*p)-1]
+	*p = (*p)[:len(*p)-1]
+	return last.node, last.index
+}
+
+// get returns a cached node and marks it as most recently used.
+// It returns nil if the node is not cached.
+func (bp *bufferPool) get(id pageID) *diskNode {
+	e, ok := bp.pages[id]
+	if !ok {
+		return nil
+	}
+	bp.lru.MoveToFront(e)
+	return e.Value.(*diskNode)
+}
+
+// add caches a node as the most recently used.
+func (bp *bufferPool) add(n *diskNode) {
+	bp.pages[n.id] = bp.lru.PushFront(n)
+}
+
+// remove removes a node from the cache without writing it.
+func (bp *bufferPool) remove(id pageID) {
+	if e, ok := bp.pages[id]; ok {
+		bp.lru.Remove(e)
+		delete(bp.pages, id)
+	}
+}
+
+func (ids *pageIDs) insert(index int, id pageID) {
+	*ids = append(*ids, 0)
+	copy((*ids)[index+1:], (*ids)[index:])
+	(*ids)[index] = id
+}
+
+func (ids *pageIDs) delete(index int) {
+	copy((*ids)[index:], (*ids)[index+1:])
+	*ids = (*ids)[:len(*ids)-1]
+}
+
+//=============================================================================
+//= Functions
+//=============================================================================
+
+// OpenDisk opens the DiskBTree stored in the file at path, creating an empty
+// tree if the file does not exist.
+func OpenDisk(path string, opts DiskOptions) (*DiskBTree, error) {
+	if opts.Codec == nil {
+		return nil, errors.New("DiskBTree requires an item codec")
+	}
+	if opts.PoolSize == 0 {
+		opts.PoolSize = defaultPoolSize
+	}
+	if opts.PoolSize < 1 {
+		return nil, errors.New("DiskBTree pool size must be positive")
+	}
+
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	d := &DiskBTree{
+		file:  file,
+		codec: opts.Codec,
+		pool: &bufferPool{
+			capacity: opts.PoolSize,
+			lru:      list.New(),
+			pages:    make(map[pageID]*list.Element),
+		},
+	}
+	if info.Size() == 0 {
+		err = d.create(opts)
+	} else {
+		err = d.open(opts)
+	}
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	return d, nil
+}
+
+// uvarintLen returns the number of bytes needed to encode x as a uvarint.
+func uvarintLen(x uint64) int {
+	n := 1
+	for ; x >= 0x80; x >>= 7 {
+		n++
+	}
+	return n
+}
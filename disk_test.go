@@ -0,0 +1,247 @@
+package btree
+
+import (
+	"errors"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestDiskBTree(t *testing.T) {
+	massItems := uniqueInputsN(2000)
+	cases := []struct {
+		order    int
+		pageSize int
+		poolSize int
+	}{
+		// Should work with small pages and pools which force eviction
+		{order: 3, pageSize: 128, poolSize: 1},
+		{order: 8, pageSize: 512, poolSize: 4},
+		// Should work with default page and pool sizes
+		{order: 50},
+	}
+
+	for _, c := range cases {
+		path := filepath.Join(t.TempDir(), "tree")
+		opts := DiskOptions{Codec: testItemCodec{}, Order: c.order, PageSize: c.pageSize, PoolSize: c.poolSize}
+		d, err := OpenDisk(path, opts)
+		if err != nil {
+			t.Fatalf("OpenDisk should not have failed: %v", err)
+		}
+
+		shuffled := append([]Item(nil), massItems...)
+		rand.Shuffle(len(shuffled), func(i, j int) { shuffled[i], shuffled[j] = shuffled[j], shuffled[i] })
+		for _, item := range shuffled {
+			if err := d.Insert(item); err != nil {
+				t.Fatalf("Insert should not have failed: %v", err)
+			}
+		}
+		// Duplicates should be ignored
+		if err := d.Insert(massItems[0]); err != nil || d.Len() != len(massItems) {
+			t.Fatalf("Duplicate Insert should have been ignored. Len: %d, error: %v", d.Len(), err)
+		}
+		checkDiskBTree(t, d, massItems)
+
+		// Should delete half of the items
+		var kept []Item
+		for i, item := range massItems {
+			if i%2 == 0 {
+				kept = append(kept, item)
+				continue
+			}
+			if err := d.Delete(item); err != nil {
+				t.Fatalf("Delete should not have failed: %v", err)
+			}
+		}
+		if err := d.Delete(&testItem{key: -1}); err != nil {
+			t.Fatalf("Delete of missing item should not have failed: %v", err)
+		}
+		checkDiskBTree(t, d, kept)
+
+		// Should persist across reopening
+		if err := d.Close(); err != nil {
+			t.Fatalf("Close should not have failed: %v", err)
+		}
+		d, err = OpenDisk(path, DiskOptions{Codec: testItemCodec{}, PoolSize: c.poolSize})
+		if err != nil {
+			t.Fatalf("Reopening should not have failed: %v", err)
+		}
+		checkDiskBTree(t, d, kept)
+
+		// Should reuse freed pages before growing the file
+		if d.freeHead == metaPage {
+			t.Fatalf("Deleting items should have freed pages")
+		}
+		numPages := d.numPages
+		for i, item := range massItems {
+			if i%2 == 1 {
+				d.Insert(item)
+			}
+		}
+		if d.numPages != numPages && d.freeHead != metaPage {
+			t.Errorf("File should only grow once free pages are used up")
+		}
+		checkDiskBTree(t, d, massItems)
+
+		// Should delete every item
+		for _, item := range shuffled {
+			if err := d.Delete(item); err != nil {
+				t.Fatalf("Delete should not have failed: %v", err)
+			}
+		}
+		checkDiskBTree(t, d, nil)
+		d.Close()
+	}
+}
+
+func TestOpenDiskErrors(t *testing.T) {
+	dir := t.TempDir()
+	existing := filepath.Join(dir, "existing")
+	d, err := OpenDisk(existing, DiskOptions{Codec: testItemCodec{}, Order: 4, PageSize: 256})
+	if err != nil {
+		t.Fatalf("OpenDisk should not have failed: %v", err)
+	}
+	d.Close()
+	garbage := filepath.Join(dir, "garbage")
+	os.WriteFile(garbage, []byte(strings.Repeat("x", 1024)), 0644)
+
+	cases := []struct {
+		path    string
+		opts    DiskOptions
+		wantErr string
+	}{
+		// Should require a codec
+		{path: filepath.Join(dir, "a"), opts: DiskOptions{Order: 4}, wantErr: "codec"},
+		// Should reject invalid orders
+		{path: filepath.Join(dir, "b"), opts: DiskOptions{Codec: testItemCodec{}, Order: 2}, wantErr: "order"},
+		// Should reject pages too small for the order
+		{path: filepath.Join(dir, "c"), opts: DiskOptions{Codec: testItemCodec{}, Order: 100, PageSize: 512}, wantErr: "too small"},
+		// Should reject options which do not match an existing file
+		{path: existing, opts: DiskOptions{Codec: testItemCodec{}, Order: 5}, wantErr: "order 4"},
+		{path: existing, opts: DiskOptions{Codec: testItemCodec{}, PageSize: 4096}, wantErr: "page size 256"},
+		// Should reject files which are not DiskBTrees
+		{path: garbage, opts: DiskOptions{Codec: testItemCodec{}}, wantErr: "not a DiskBTree"},
+	}
+
+	for _, c := range cases {
+		d, err := OpenDisk(c.path, c.opts)
+		if err == nil {
+			d.Close()
+		}
+		if err == nil || !strings.Contains(err.Error(), c.wantErr) {
+			t.Errorf("OpenDisk error should contain %q. Got: %v", c.wantErr, err)
+		}
+	}
+
+	// Should reject items which could overflow a page
+	d, _ = OpenDisk(filepath.Join(dir, "d"), DiskOptions{Codec: paddedCodec{size: 100}, Order: 4, PageSize: 128})
+	defer d.Close()
+	if err := d.Insert(&testItem{}); err == nil {
+		t.Errorf("Insert of oversized item should have failed")
+	}
+}
+
+//=============================================================================
+//= Helpers
+//=============================================================================
+
+// A paddedCodec is an ItemCodec which encodes testItems with padding up to
+// a fixed size.
+type paddedCodec struct {
+	size int
+}
+
+func (c paddedCodec) MarshalItem(item Item) ([]byte, error) {
+	data, _ := testItemCodec{}.MarshalItem(item)
+	return append(data, make([]byte, c.size-len(data))...), nil
+}
+
+func (c paddedCodec) UnmarshalItem(data []byte) (Item, error) {
+	return testItemCodec{}.UnmarshalItem(data[:16])
+}
+
+// checkDiskBTree checks that a DiskBTree satisfies the B-Tree invariants and
+// contains exactly the given sorted items.
+func checkDiskBTree(t *testing.T, d *DiskBTree, want []Item) {
+	t.Helper()
+	if d.Len() != len(want) {
+		t.Fatalf("DiskBTree should contain %d items. Got: %d", len(want), d.Len())
+	}
+	leafDepth := -1
+	var walk func(id pageID, depth int, lo, hi Item)
+	walk = func(id pageID, depth int, lo, hi Item) {
+		n, err := d.node(id)
+		if err != nil {
+			t.Fatalf("Reading page %d should not have failed: %v", id, err)
+		}
+		if id != d.root && (len(n.items) < (d.order+1)/2-1 || len(n.items) == 0) {
+			t.Fatalf("Page %d has too few items: %d", id, len(n.items))
+		}
+		if len(n.items) > d.order-1 {
+			t.Fatalf("Page %d has too many items: %d", id, len(n.items))
+		}
+		for i, item := range n.items {
+			if (i > 0 && !n.items[i-1].Less(item)) || (lo != nil && !lo.Less(item)) || (hi != nil && !item.Less(hi)) {
+				t.Fatalf("Page %d has out of order item %v", id, item)
+			}
+		}
+		if len(n.children) == 0 {
+			if leafDepth == -1 {
+				leafDepth = depth
+			} else if depth != leafDepth {
+				t.Fatalf("Leaf page %d is at depth %d, other leaves are at %d", id, depth, leafDepth)
+			}
+			return
+		}
+		if len(n.children) != len(n.items)+1 {
+			t.Fatalf("Page %d has %d children but %d items", id, len(n.children), len(n.items))
+		}
+		children := append(pageIDs(nil), n.children...)
+		its := append(items(nil), n.items...)
+		for i, c := range children {
+			childLo, childHi := lo, hi
+			if i > 0 {
+				childLo = its[i-1]
+			}
+			if i < len(its) {
+				childHi = its[i]
+			}
+			walk(c, depth+1, childLo, childHi)
+		}
+	}
+	walk(d.root, 0, nil, nil)
+	d.trim()
+
+	for _, item := range want {
+		found, err := d.Search(item)
+		if err != nil || found.Less(item) || item.Less(found) {
+			t.Fatalf("Search should have found %v. Got: %v, error: %v", item, found, err)
+		}
+	}
+	if found, err := d.Search(&testItem{key: -1}); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("Search should not have found missing item. Got: %v", found)
+	}
+
+	iter := d.NewIterator()
+	for _, item := range want {
+		next, err := iter.Next()
+		if err != nil || next.Less(item) || item.Less(next) {
+			t.Fatalf("Iterator should have returned %v. Got: %v, error: %v", item, next, err)
+		}
+	}
+	if iter.HasNext() {
+		t.Fatalf("Iterator should no longer have next")
+	}
+	iter = d.NewReverseIterator()
+	for i := len(want) - 1; i >= 0; i-- {
+		next, err := iter.Next()
+		if err != nil || next.Less(want[i]) || want[i].Less(next) {
+			t.Fatalf("Reverse iterator should have returned %v. Got: %v, error: %v", want[i], next, err)
+		}
+	}
+	if iter.HasNext() {
+		t.Fatalf("Reverse iterator should no longer have next")
+	}
+}
@@ -0,0 +1,293 @@
+package btree
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+//=============================================================================
+//= Types
+//=============================================================================
+
+// ExpiringOptions configures an ExpiringTree.
+type ExpiringOptions struct {
+	// Now returns the current time, defaulting to time.Now.
+	Now func() time.Time
+}
+
+// An ExpiringTree is a BTree whose items expire after a time to live.
+//
+// Expired items are invisible to Search and iteration. They are removed from
+// the tree lazily, when they are found by Search, and in bulk by Reap, which
+// can also be run periodically on a background goroutine.
+//
+// An ExpiringTree is safe for concurrent use.
+type ExpiringTree struct {
+	mu        sync.Mutex // Guards the fields below.
+	tree      *BTree     // Items, as expiringItems.
+	deadlines *BTree     // Items which expire, as deadlineItems.
+	count     int        // Number of items, including unreaped expired items.
+	now       func() time.Time
+
+	stop chan struct{} // Closed to stop the reaper, or nil if not running.
+	done chan struct{} // Closed once the reaper has stopped.
+}
+
+// An expiringItem is an item in an ExpiringTree, ordered by the item.
+type expiringItem struct {
+	item     Item
+	deadline time.Time // Time the item expires, or zero if it does not.
+}
+
+// A deadlineItem is an item in an ExpiringTree, ordered by its deadline and
+// then by the item.
+type deadlineItem struct {
+	*expiringItem
+}
+
+// An ExpiringIterator is a stateful iterator over the unexpired items of an
+// ExpiringTree.
+type ExpiringIterator struct {
+	tree *ExpiringTree
+	next Item // Next item to return, or nil if exhausted.
+	last Item // Most recently found item, or nil if none has been found.
+}
+
+//=============================================================================
+//= Methods
+//=============================================================================
+
+// Insert inserts an item which expires once ttl has passed. An item with a
+// ttl of zero or less does not expire.
+//
+// Unlike BTree.Insert, inserting an item which is already in the tree
+// replaces it, along with its deadline.
+func (e *ExpiringTree) Insert(item Item, ttl time.Duration) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.delete(item)
+	it := &expiringItem{item: item}
+	if ttl > 0 {
+		it.deadline = e.now().Add(ttl)
+		e.deadlines.Insert(deadlineItem{it})
+	}
+	e.tree.Insert(it)
+	e.count++
+}
+
+// Delete deletes an item from the tree.
+//
+// If the item to delete does not exist in the tree, the method will fail
+// silently.
+func (e *ExpiringTree) Delete(item Item) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.delete(item)
+}
+
+// Search searches for an unexpired item in the tree.
+//
+// If the item is found, the method returns it and true.
+// Otherwise, the function returns nil and false.
+func (e *ExpiringTree) Search(item Item) (Item, bool) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	found, ok := e.tree.Search(&expiringItem{item: item})
+	if !ok {
+		return nil, false
+	}
+	it := found.(*expiringItem)
+	if it.expired(e.now()) {
+		e.delete(item)
+		return nil, false
+	}
+	return it.item, true
+}
+
+// Len returns the number of unexpired items in the tree.
+// Expired items are reaped first.
+func (e *ExpiringTree) Len() int {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.reap()
+	return e.count
+}
+
+// NewIterator returns a new iterator over the unexpired items of the tree.
+//
+// Items are checked for expiry as the iterator reaches them. The iterator
+// remains valid while the tree changes, and returns the unexpired items
+// after the last one it returned at the time it reaches them.
+func (e *ExpiringTree) NewIterator() *ExpiringIterator {
+	iter := &ExpiringIterator{tree: e}
+	iter.advance()
+	return iter
+}
+
+// Reap removes expired items from the tree, and returns the number removed.
+func (e *ExpiringTree) Reap() int {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.reap()
+}
+
+// StartReaper starts a background goroutine which reaps the tree every
+// interval, until it is stopped with StopReaper.
+func (e *ExpiringTree) StartReaper(interval time.Duration) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.stop != nil {
+		return errors.New("reaper is already running")
+	}
+	if interval <= 0 {
+		return errors.New("reaper interval must be positive")
+	}
+	e.stop, e.done = make(chan struct{}), make(chan struct{})
+	go e.runReaper(interval, e.stop, e.done)
+	return nil
+}
+
+// StopReaper stops the background reaper and waits for it to exit. Stopping
+// a reaper which is not running has no effect.
+func (e *ExpiringTree) StopReaper() {
+	e.mu.Lock()
+	stop, done := e.stop, e.done
+	e.stop, e.done = nil, nil
+	e.mu.Unlock()
+	if stop != nil {
+		close(stop)
+		<-done
+	}
+}
+
+// runReaper reaps the tree every interval until stop is closed.
+func (e *ExpiringTree) runReaper(interval time.Duration, stop, done chan struct{}) {
+	defer close(done)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			e.Reap()
+		}
+	}
+}
+
+// delete deletes an item, whether or not it has expired.
+//
+// NOTE: e.mu must be held.
+func (e *ExpiringTree) delete(item Item) {
+	container, i := e.tree.search(&expiringItem{item: item})
+	if i == -1 {
+		return
+	}
+	it := container.items[i].(*expiringItem)
+	e.tree.Delete(it)
+	e.count--
+	if !it.deadline.IsZero() {
+		e.deadlines.Delete(deadlineItem{it})
+	}
+}
+
+// reap removes expired items from the tree, and returns the number removed.
+//
+// NOTE: e.mu must be held.
+func (e *ExpiringTree) reap() int {
+	now := e.now()
+	var expired []*expiringItem
+	for iter := e.deadlines.NewIterator(); iter.HasNext(); {
+		next, _ := iter.Next()
+		it := next.(deadlineItem).expiringItem
+		if !it.expired(now) {
+			break
+		}
+		expired = append(expired, it)
+	}
+	for _, it := range expired {
+		e.tree.Delete(it)
+		e.deadlines.Delete(deadlineItem{it})
+	}
+	e.count -= len(expired)
+	return len(expired)
+}
+
+// Less compares the items of two expiringItems.
+func (it *expiringItem) Less(other Item) bool {
+	return it.item.Less(other.(*expiringItem).item)
+}
+
+// expired determines if the item has expired at time now.
+func (it *expiringItem) expired(now time.Time) bool {
+	return !it.deadline.IsZero() && !now.Before(it.deadline)
+}
+
+// Less compares two deadlineItems by deadline, and then by item.
+func (d deadlineItem) Less(other Item) bool {
+	o := other.(deadlineItem)
+	if !d.deadline.Equal(o.deadline) {
+		return d.deadline.Before(o.deadline)
+	}
+	return d.item.Less(o.item)
+}
+
+// HasNext determines if iterator can iterate.
+func (ei *ExpiringIterator) HasNext() bool {
+	return ei.next != nil
+}
+
+// Next moves the iterator forward and returns its previous value.
+func (ei *ExpiringIterator) Next() (Item, error) {
+	if !ei.HasNext() {
+		return nil, ErrIteratorExhausted
+	}
+	next := ei.next
+	ei.advance()
+	return next, nil
+}
+
+// advance finds the next unexpired item to return.
+//
+// Because nodes may be freed and reused as the tree changes, the iterator
+// does not hold on to the tree's nodes, but seeks past the last item it
+// found each time.
+func (ei *ExpiringIterator) advance() {
+	e := ei.tree
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	now := e.now()
+	iter := e.tree.NewIterator()
+	if ei.last != nil {
+		iter = e.tree.NewIteratorFrom(&expiringItem{item: ei.last})
+	}
+	ei.next = nil
+	for iter.HasNext() {
+		next, _ := iter.Next()
+		it := next.(*expiringItem)
+		if ei.last != nil && !ei.last.Less(it.item) {
+			continue
+		}
+		if !it.expired(now) {
+			ei.next, ei.last = it.item, it.item
+			return
+		}
+	}
+}
+
+//=============================================================================
+//= Functions
+//=============================================================================
+
+// NewExpiring returns an empty ExpiringTree of the given order.
+func NewExpiring(order int, opts ExpiringOptions) *ExpiringTree {
+	if opts.Now == nil {
+		opts.Now = time.Now
+	}
+	return &ExpiringTree{
+		tree:      New(order),
+		deadlines: New(order),
+		now:       opts.Now,
+	}
+}
@@ -0,0 +1,219 @@
+package btree
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestExpiringTree(t *testing.T) {
+	now := time.Unix(0, 0)
+	e := NewExpiring(3, ExpiringOptions{Now: func() time.Time { return now }})
+
+	// Key i expires after i seconds, and key 0 does not expire.
+	for i := 0; i < 100; i++ {
+		e.Insert(&testItem{key: i}, time.Duration(i)*time.Second)
+	}
+	if e.Len() != 100 {
+		t.Fatalf("ExpiringTree should contain 100 items. Got: %d", e.Len())
+	}
+
+	now = now.Add(50 * time.Second)
+	// Expired items should be invisible to Search and iteration
+	for i := 0; i < 100; i++ {
+		_, found := e.Search(&testItem{key: i})
+		if live := i == 0 || i > 50; live != found {
+			t.Errorf("Search(%d) should have returned %v at 50s. Got: %v", i, live, found)
+		}
+	}
+	iter := e.NewIterator()
+	for _, want := range append([]int{0}, rangeInts(51, 100)...) {
+		next, err := iter.Next()
+		if err != nil || next.(*testItem).key != want {
+			t.Fatalf("Iterator should have returned key %d. Got: %v, error: %v", want, next, err)
+		}
+	}
+	if iter.HasNext() {
+		t.Fatalf("Iterator should no longer have next")
+	}
+
+	// Should skip items which expire during iteration, apart from the next
+	// item, which has already been found
+	iter = e.NewIterator()
+	iter.Next()
+	now = now.Add(25 * time.Second)
+	for _, want := range append([]int{51}, rangeInts(76, 100)...) {
+		next, err := iter.Next()
+		if err != nil || next.(*testItem).key != want {
+			t.Fatalf("Iterator should have returned key %d. Got: %v, error: %v", want, next, err)
+		}
+	}
+	if iter.HasNext() {
+		t.Fatalf("Iterator should no longer have next")
+	}
+	now = now.Add(-25 * time.Second)
+
+	// Search should have removed the expired items it found
+	if n := e.Reap(); n != 0 {
+		t.Errorf("Reap should have found no expired items left. Got: %d", n)
+	}
+	now = now.Add(10 * time.Second)
+	if n := e.Reap(); n != 10 {
+		t.Errorf("Reap should have removed 10 items. Got: %d", n)
+	}
+	if e.Len() != 40 {
+		t.Errorf("ExpiringTree should contain 40 items. Got: %d", e.Len())
+	}
+
+	// Should replace items and their deadlines
+	e.Insert(&testItem{key: 99, val: 1}, 0)
+	e.Insert(&testItem{key: 0, val: 1}, time.Second)
+	now = now.Add(time.Hour)
+	if found, ok := e.Search(&testItem{key: 99}); !ok || found.(*testItem).val != 1 {
+		t.Errorf("Replaced item should no longer expire. Got: %v", found)
+	}
+	if _, ok := e.Search(&testItem{key: 0}); ok {
+		t.Errorf("Replaced item should have expired")
+	}
+	e.Delete(&testItem{key: 99})
+	if e.Len() != 0 || len(e.tree.root.items) != 0 || len(e.deadlines.root.items) != 0 {
+		t.Errorf("ExpiringTree should be empty. Got: %d items", e.Len())
+	}
+}
+
+func TestExpiringReaper(t *testing.T) {
+	var mu sync.Mutex
+	now := time.Unix(0, 0)
+	clock := func() time.Time {
+		mu.Lock()
+		defer mu.Unlock()
+		return now
+	}
+	e := NewExpiring(4, ExpiringOptions{Now: clock})
+	for i := 0; i < 10; i++ {
+		e.Insert(&testItem{key: i}, time.Second)
+	}
+
+	if err := e.StartReaper(time.Millisecond); err != nil {
+		t.Fatalf("StartReaper should not have failed: %v", err)
+	}
+	if err := e.StartReaper(time.Millisecond); err == nil {
+		t.Errorf("Starting a second reaper should have failed")
+	}
+	mu.Lock()
+	now = now.Add(time.Minute)
+	mu.Unlock()
+
+	// The reaper should remove the expired items in the background
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		e.mu.Lock()
+		count := e.count
+		e.mu.Unlock()
+		if count == 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Reaper should have removed the expired items. %d remain", count)
+		}
+		time.Sleep(time.Millisecond)
+	}
+	e.StopReaper()
+	e.StopReaper()
+
+	// Should restart after being stopped
+	if err := e.StartReaper(time.Millisecond); err != nil {
+		t.Errorf("Restarting the reaper should not have failed: %v", err)
+	}
+	e.StopReaper()
+}
+
+func TestExpiringIteratorChanges(t *testing.T) {
+	var mu sync.Mutex
+	now := time.Unix(0, 0)
+	clock := func() time.Time {
+		mu.Lock()
+		defer mu.Unlock()
+		return now
+	}
+	advance := func(d time.Duration) {
+		mu.Lock()
+		now = now.Add(d)
+		mu.Unlock()
+	}
+
+	// Even keys do not expire, and odd keys expire after a second.
+	e := NewExpiring(3, ExpiringOptions{Now: clock})
+	for i := 0; i < 200; i++ {
+		e.Insert(&testItem{key: i}, time.Duration(i%2)*time.Second)
+	}
+
+	// Should survive expired items being deleted by Search
+	iter := e.NewIterator()
+	iter.Next()
+	advance(time.Minute)
+	for i := 0; i < 200; i++ {
+		e.Search(&testItem{key: i})
+	}
+	want := []int{1}
+	for i := 2; i < 200; i += 2 {
+		want = append(want, i)
+	}
+	for _, key := range want {
+		next, err := iter.Next()
+		if err != nil || next.(*testItem).key != key {
+			t.Fatalf("Iterator should have returned key %d. Got: %v, error: %v", key, next, err)
+		}
+	}
+	if iter.HasNext() {
+		t.Fatalf("Iterator should no longer have next")
+	}
+
+	// Should survive items being reaped in the background
+	for i := 1; i < 200; i += 2 {
+		e.Insert(&testItem{key: i}, time.Second)
+	}
+	if err := e.StartReaper(time.Microsecond); err != nil {
+		t.Fatalf("StartReaper should not have failed: %v", err)
+	}
+	defer e.StopReaper()
+	iter = e.NewIterator()
+	var got []int
+	for iter.HasNext() {
+		next, _ := iter.Next()
+		got = append(got, next.(*testItem).key)
+		if len(got) == 10 {
+			advance(time.Minute)
+		}
+		time.Sleep(10 * time.Microsecond)
+	}
+	// Every even key should be returned, in order, along with the odd keys
+	// returned before they expired.
+	evens := 0
+	for i, key := range got {
+		if i > 0 && key <= got[i-1] {
+			t.Fatalf("Iterator should have returned ascending keys. Got: %v", got)
+		}
+		if key%2 == 0 {
+			evens++
+		} else if i > 10 {
+			t.Fatalf("Iterator should not have returned expired key %d", key)
+		}
+	}
+	if evens != 100 {
+		t.Errorf("Iterator should have returned 100 even keys. Got: %d", evens)
+	}
+}
+
+//=============================================================================
+//= Helpers
+//=============================================================================
+
+// rangeInts returns the integers in [lo, hi).
+func rangeInts(lo, hi int) []int {
+	var ints []int
+	for i := lo; i < hi; i++ {
+		ints = append(ints, i)
+	}
+	return ints
+}
@@ -0,0 +1,80 @@
+package btree
+
+import (
+	"sync"
+)
+
+//=============================================================================
+//= Variables and Constants
+//=============================================================================
+
+// DefaultFreeListSize is the capacity of the FreeList of a BTree created
+// without one.
+const DefaultFreeListSize = 32
+
+//=============================================================================
+//= Types
+//=============================================================================
+
+// A FreeList holds nodes discarded by BTrees for reuse, along with their item
+// and child slices, reducing allocation and garbage collection under heavy
+// insert and delete churn.
+//
+// A FreeList is safe for concurrent use, so it can be shared by multiple
+// BTrees, even when they are used from different goroutines.
+type FreeList struct {
+	mu    sync.Mutex
+	nodes []*node
+}
+
+//=============================================================================
+//= Methods
+//=============================================================================
+
+// Len returns the number of nodes held by the FreeList.
+func (f *FreeList) Len() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return len(f.nodes)
+}
+
+// newNode returns a node from the FreeList, or a newly allocated node if the
+// FreeList is empty.
+func (f *FreeList) newNode() *node {
+	f.mu.Lock()
+	if last := len(f.nodes) - 1; last >= 0 {
+		n := f.nodes[last]
+		f.nodes[last] = nil
+		f.nodes = f.nodes[:last]
+		f.mu.Unlock()
+		return n
+	}
+	f.mu.Unlock()
+	return &node{}
+}
+
+// freeNode clears a node and adds it to the FreeList, unless the FreeList is
+// full.
+//
+// NOTE: The node must no longer be reachable from any tree.
+func (f *FreeList) freeNode(n *node) {
+	// Clear references so that freed nodes do not keep items alive.
+	n.items.truncate(0)
+	n.children.truncate(0)
+	n.parent = nil
+
+	f.mu.Lock()
+	if len(f.nodes) < cap(f.nodes) {
+		f.nodes = append(f.nodes, n)
+	}
+	f.mu.Unlock()
+}
+
+//=============================================================================
+//= Functions
+//=============================================================================
+
+// NewFreeList returns a FreeList which holds up to size nodes.
+func NewFreeList(size int) *FreeList {
+	return &FreeList{nodes: make([]*node, 0, size)}
+}
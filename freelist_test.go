@@ -0,0 +1,71 @@
+package btree
+
+import (
+	"sync"
+	"testing"
+)
+
+func TestFreeList(t *testing.T) {
+	massItems := uniqueInputsN(2000)
+	f := NewFreeList(16)
+	b, _ := NewWithOptions(Options{Order: 4, FreeList: f})
+	b.InsertBatch(massItems)
+
+	// Should keep nodes freed by merges, up to its capacity
+	for _, item := range massItems[:1000] {
+		b.Delete(item)
+	}
+	if f.Len() != 16 {
+		t.Errorf("FreeList should hold 16 nodes. Got: %d", f.Len())
+	}
+	for _, n := range f.nodes {
+		if len(n.items) != 0 || len(n.children) != 0 || n.parent != nil {
+			t.Fatalf("Freed nodes should be cleared")
+		}
+	}
+
+	// Should reuse freed nodes
+	for _, item := range massItems[:1000] {
+		b.Insert(item)
+	}
+	if f.Len() != 0 {
+		t.Errorf("FreeList should have been drained by inserts. Got: %d", f.Len())
+	}
+	checkLoaded(t, b, b.Validate(), massItems, false)
+
+	// Should hold nothing with a capacity of zero
+	empty := NewFreeList(0)
+	b, _ = NewWithOptions(Options{Order: 3, FreeList: empty})
+	b.InsertBatch(massItems)
+	for _, item := range massItems {
+		b.Delete(item)
+	}
+	if empty.Len() != 0 {
+		t.Errorf("FreeList of capacity 0 should hold no nodes. Got: %d", empty.Len())
+	}
+}
+
+func TestFreeListShared(t *testing.T) {
+	f := NewFreeList(64)
+	var wg sync.WaitGroup
+	for g := 0; g < 4; g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			b, _ := NewWithOptions(Options{Order: 3, FreeList: f})
+			massItems := uniqueInputsN(500)
+			for round := 0; round < 5; round++ {
+				for _, item := range massItems {
+					b.Insert(item)
+				}
+				for _, item := range massItems[:400] {
+					b.Delete(item)
+				}
+			}
+			if err := b.Validate(); err != nil {
+				t.Errorf("Tree sharing a FreeList should be valid: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+}
@@ -0,0 +1,211 @@
+package btree
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+//=============================================================================
+//= Types
+//=============================================================================
+
+// HistoryOptions configures the retention policy of a History.
+type HistoryOptions struct {
+	// MaxVersions is the number of most recent versions to retain. Zero
+	// disables the limit.
+	MaxVersions int
+
+	// MaxAge discards versions which were superseded more than this long
+	// ago. Zero disables the limit.
+	MaxAge time.Duration
+
+	// Now returns the current time, defaulting to time.Now.
+	Now func() time.Time
+}
+
+// A History is a B-Tree which retains its past versions, so that they can be
+// queried by version number or by time.
+//
+// Like an MVCC, a History is a persistent tree whose versions share all
+// unchanged nodes. Versions are discarded according to the History's
+// retention policy, but the current version is always retained.
+//
+// A History is safe for concurrent use.
+type History struct {
+	mu       sync.RWMutex // Guards versions and first.
+	order    int
+	opts     HistoryOptions
+	versions []historyVersion // Retained versions, oldest first.
+	first    uint64           // Version number of versions[0].
+}
+
+// A historyVersion is a version retained by a History.
+type historyVersion struct {
+	root    *cowNode
+	count   int
+	created time.Time
+}
+
+//=============================================================================
+//= Methods
+//=============================================================================
+
+// Insert inserts an item into a new version of the tree.
+//
+// If the item is already in the tree, no new version is produced.
+func (h *History) Insert(item Item) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	current := h.versions[len(h.versions)-1]
+	if root, ok := cowInsert(current.root, h.order, item); ok {
+		h.push(root, current.count+1)
+	}
+}
+
+// Delete deletes an item from a new version of the tree.
+//
+// If the item is not in the tree, no new version is produced.
+func (h *History) Delete(item Item) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	current := h.versions[len(h.versions)-1]
+	if root, ok := cowDelete(current.root, h.order, item); ok {
+		h.push(root, current.count-1)
+	}
+}
+
+// Version returns the current version number of the tree.
+// Version numbers start at zero and increase with every change.
+func (h *History) Version() uint64 {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return h.first + uint64(len(h.versions)) - 1
+}
+
+// Oldest returns the oldest version number which is still retained.
+func (h *History) Oldest() uint64 {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return h.first
+}
+
+// LenAt returns the number of items in a version of the tree.
+func (h *History) LenAt(version uint64) (int, error) {
+	v, err := h.at(version)
+	if err != nil {
+		return 0, err
+	}
+	return v.count, nil
+}
+
+// SearchAt searches for an item in a version of the tree.
+//
+// If the item is found, the method returns it.
+// Otherwise, the function returns nil and ErrNotFound, or an error
+// indicating that the version is not retained.
+func (h *History) SearchAt(item Item, version uint64) (Item, error) {
+	v, err := h.at(version)
+	if err != nil {
+		return nil, err
+	}
+	if found, ok := v.root.search(item); ok {
+		return found, nil
+	}
+	return nil, ErrNotFound
+}
+
+// IterateAt returns a new iterator over a version of the tree.
+func (h *History) IterateAt(version uint64) (*SnapshotIterator, error) {
+	v, err := h.at(version)
+	if err != nil {
+		return nil, err
+	}
+	return &SnapshotIterator{*newCowIterator(v.root, forward)}, nil
+}
+
+// VersionAt returns the version of the tree which was current at time t.
+// It fails if that version is no longer retained.
+func (h *History) VersionAt(t time.Time) (uint64, error) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	// Find the last version created no later than t.
+	i := sort.Search(len(h.versions), func(i int) bool {
+		return h.versions[i].created.After(t)
+	}) - 1
+	if i < 0 {
+		return 0, fmt.Errorf("no version retained in History at %v", t)
+	}
+	return h.first + uint64(i), nil
+}
+
+// Prune discards the versions which fall outside the retention policy.
+//
+// Versions are pruned after every change, but a History which is not being
+// changed must be pruned explicitly to discard versions as they age.
+func (h *History) Prune() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.prune()
+}
+
+// push adds a new current version and prunes the versions which fall outside
+// the retention policy.
+//
+// NOTE: h.mu must be held.
+func (h *History) push(root *cowNode, count int) {
+	h.versions = append(h.versions, historyVersion{root: root, count: count, created: h.opts.Now()})
+	h.prune()
+}
+
+// prune discards the versions which fall outside the retention policy.
+//
+// NOTE: h.mu must be held.
+func (h *History) prune() {
+	drop := 0
+	if max := h.opts.MaxVersions; max > 0 && len(h.versions) > max {
+		drop = len(h.versions) - max
+	}
+	if h.opts.MaxAge > 0 {
+		// A version is superseded when its successor is created.
+		cutoff := h.opts.Now().Add(-h.opts.MaxAge)
+		for drop < len(h.versions)-1 && h.versions[drop+1].created.Before(cutoff) {
+			drop++
+		}
+	}
+	if drop == 0 {
+		return
+	}
+	// Clear the dropped versions so that their nodes can be reclaimed.
+	for i := range h.versions[:drop] {
+		h.versions[i] = historyVersion{}
+	}
+	h.versions = h.versions[drop:]
+	h.first += uint64(drop)
+}
+
+// at returns a retained version of the tree.
+func (h *History) at(version uint64) (historyVersion, error) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	if version < h.first || version-h.first >= uint64(len(h.versions)) {
+		return historyVersion{}, fmt.Errorf("version %d is not retained in History", version)
+	}
+	return h.versions[version-h.first], nil
+}
+
+//=============================================================================
+//= Functions
+//=============================================================================
+
+// NewHistory returns an empty History of the given order, whose version zero
+// is the empty tree.
+func NewHistory(order int, opts HistoryOptions) *History {
+	if opts.Now == nil {
+		opts.Now = time.Now
+	}
+	h := &History{order: order, opts: opts}
+	h.versions = []historyVersion{{created: opts.Now()}}
+	return h
+}
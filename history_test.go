@@ -0,0 +1,145 @@
+package btree
+
+import (
+	"math/rand"
+	"testing"
+	"time"
+)
+
+func TestHistory(t *testing.T) {
+	now := time.Unix(0, 0)
+	h := NewHistory(4, HistoryOptions{Now: func() time.Time { return now }})
+
+	// Record the expected contents of every version.
+	wants := []map[int]int{{}}
+	model := make(map[int]int)
+	for i := 0; i < 1000; i++ {
+		now = now.Add(time.Second)
+		key := rand.Intn(200)
+		if rand.Intn(3) > 0 {
+			if _, ok := model[key]; ok {
+				continue
+			}
+			h.Insert(&testItem{key: key, val: i})
+			model[key] = i
+		} else {
+			if _, ok := model[key]; !ok {
+				continue
+			}
+			h.Delete(&testItem{key: key})
+			delete(model, key)
+		}
+		want := make(map[int]int, len(model))
+		for k, v := range model {
+			want[k] = v
+		}
+		wants = append(wants, want)
+		if h.Version() != uint64(len(wants)-1) {
+			t.Fatalf("Change should have produced version %d. Got: %d", len(wants)-1, h.Version())
+		}
+	}
+	// Ignored changes should not produce new versions
+	version := h.Version()
+	h.Delete(&testItem{key: -1})
+	if h.Version() != version {
+		t.Errorf("Ignored change should not have produced a new version")
+	}
+
+	// Should query every version
+	for version, want := range wants {
+		checkHistoryAt(t, h, uint64(version), want)
+	}
+
+	// Should find the version current at a given time
+	first, _ := h.VersionAt(time.Unix(0, 0))
+	later, _ := h.VersionAt(now.Add(time.Hour))
+	if first != 0 || later != h.Version() {
+		t.Errorf("VersionAt should have returned versions 0 and %d. Got: %d and %d", h.Version(), first, later)
+	}
+	if _, err := h.VersionAt(time.Unix(-1, 0)); err == nil {
+		t.Errorf("VersionAt should have failed for a time before the first version")
+	}
+	if _, err := h.SearchAt(&testItem{key: 0}, h.Version()+1); err == nil {
+		t.Errorf("SearchAt should have failed for a future version")
+	}
+}
+
+func TestHistoryRetention(t *testing.T) {
+	cases := []struct {
+		opts       HistoryOptions
+		advance    time.Duration // Time to advance before pruning.
+		wantOldest uint64
+	}{
+		// Should retain every version without a policy
+		{opts: HistoryOptions{}, wantOldest: 0},
+		// Should retain the most recent versions
+		{opts: HistoryOptions{MaxVersions: 10}, wantOldest: 91},
+		// Should discard versions superseded too long ago
+		{opts: HistoryOptions{MaxAge: 30 * time.Second}, wantOldest: 69},
+		{opts: HistoryOptions{MaxAge: 30 * time.Second}, advance: time.Hour, wantOldest: 100},
+		// Should apply the stricter of both policies
+		{opts: HistoryOptions{MaxVersions: 50, MaxAge: 30 * time.Second}, wantOldest: 69},
+		{opts: HistoryOptions{MaxVersions: 10, MaxAge: 30 * time.Second}, wantOldest: 91},
+	}
+
+	for _, c := range cases {
+		now := time.Unix(0, 0)
+		c.opts.Now = func() time.Time { return now }
+		h := NewHistory(3, c.opts)
+		// Version i is created at i seconds.
+		for i := 0; i < 100; i++ {
+			now = now.Add(time.Second)
+			h.Insert(&testItem{key: i})
+		}
+		now = now.Add(c.advance)
+		h.Prune()
+
+		if h.Oldest() != c.wantOldest {
+			t.Errorf("Oldest retained version should be %d. Got: %d", c.wantOldest, h.Oldest())
+		}
+		if _, err := h.IterateAt(c.wantOldest); err != nil {
+			t.Errorf("Oldest retained version should be queryable: %v", err)
+		}
+		if c.wantOldest > 0 {
+			if _, err := h.SearchAt(&testItem{key: 0}, c.wantOldest-1); err == nil {
+				t.Errorf("Discarded version should not be queryable")
+			}
+		}
+		// The current version should always be retained
+		if n, err := h.LenAt(h.Version()); err != nil || n != 100 {
+			t.Errorf("Current version should hold 100 items. Got: %d, error: %v", n, err)
+		}
+	}
+}
+
+//=============================================================================
+//= Helpers
+//=============================================================================
+
+// checkHistoryAt checks that a version of a History holds exactly the items
+// in want, which maps keys to values.
+func checkHistoryAt(t *testing.T, h *History, version uint64, want map[int]int) {
+	t.Helper()
+	if n, err := h.LenAt(version); err != nil || n != len(want) {
+		t.Fatalf("Version %d should contain %d items. Got: %d, error: %v", version, len(want), n, err)
+	}
+	for k, v := range want {
+		found, err := h.SearchAt(&testItem{key: k}, version)
+		if err != nil || found.(*testItem).val != v {
+			t.Fatalf("Version %d should contain key %d with value %d. Got: %v, error: %v", version, k, v, found, err)
+		}
+	}
+	iter, err := h.IterateAt(version)
+	if err != nil {
+		t.Fatalf("IterateAt(%d) should not have failed: %v", version, err)
+	}
+	for _, k := range sortedKeys(want) {
+		next, err := iter.Next()
+		if err != nil || next.(*testItem).key != k {
+			t.Fatalf("Version %d iterator should have returned key %d. Got: %v, error: %v", version, k, next, err)
+		}
+	}
+	if iter.HasNext() {
+		t.Fatalf("Version %d iterator should no longer have next", version)
+	}
+}
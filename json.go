@@ -0,0 +1,101 @@
+package btree
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+//=============================================================================
+//= Types
+//=============================================================================
+
+// An ItemFactory decodes a single JSON value into an Item.
+//
+// A factory must be set with SetItemFactory before a BTree can be decoded
+// with UnmarshalJSON.
+type ItemFactory func(data json.RawMessage) (Item, error)
+
+// A jsonNode is the JSON representation of a node, used by MarshalJSONNodes.
+type jsonNode struct {
+	Items    []Item      `json:"items"`
+	Children []*jsonNode `json:"children,omitempty"`
+}
+
+//=============================================================================
+//= Methods
+//=============================================================================
+
+// SetItemFactory sets the factory used to decode the BTree's items from JSON.
+func (b *BTree) SetItemFactory(f ItemFactory) {
+	b.factory = f
+}
+
+// MarshalJSON implements the json.Marshaler interface.
+//
+// The BTree is encoded as a JSON array of its items in ascending order. Each
+// item is encoded with json.Marshal.
+func (b *BTree) MarshalJSON() ([]byte, error) {
+	all := make([]Item, 0)
+	for iter := b.NewIterator(); iter.HasNext(); {
+		item, _ := iter.Next()
+		all = append(all, item)
+	}
+	return json.Marshal(all)
+}
+
+// MarshalJSONNodes encodes the node structure of the BTree as JSON.
+//
+// Each node is encoded as an object with an "items" array and, for internal
+// nodes, a "children" array of nodes.
+//
+// NOTE: Intended primarily for debugging. The result cannot be decoded with
+// UnmarshalJSON.
+func (b *BTree) MarshalJSONNodes() ([]byte, error) {
+	return json.Marshal(toJSONNode(b.root))
+}
+
+// UnmarshalJSON implements the json.Unmarshaler interface.
+//
+// It replaces the contents of the BTree with the items in data, which must be
+// a JSON array of items in strictly ascending order. Items are decoded with
+// the tree's item factory, and the tree keeps its existing order.
+func (b *BTree) UnmarshalJSON(data []byte) error {
+	if b.factory == nil {
+		return errors.New("BTree has no item factory")
+	}
+	if b.order < 3 {
+		return fmt.Errorf("BTree must be created with New before decoding: %w", ErrInvalidOrder)
+	}
+
+	var raw []json.RawMessage
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	bl := newBulkloader(b.order)
+	for _, r := range raw {
+		item, err := b.factory(r)
+		if err != nil {
+			return err
+		}
+		if err := bl.addChecked(item); err != nil {
+			return err
+		}
+	}
+	b.root = bl.tree.root
+	return nil
+}
+
+//=============================================================================
+//= Functions
+//=============================================================================
+
+// toJSONNode recursively converts the subtree rooted at n to jsonNodes.
+func toJSONNode(n *node) *jsonNode {
+	jn := &jsonNode{Items: make([]Item, 0, len(n.items))}
+	jn.Items = append(jn.Items, n.items...)
+	for _, c := range n.children {
+		jn.Children = append(jn.Children, toJSONNode(c))
+	}
+	return jn
+}
@@ -0,0 +1,105 @@
+package btree
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestMarshalJSON(t *testing.T) {
+	cases := []struct {
+		items []Item
+		order int
+		want  string
+	}{
+		// Should encode empty trees as empty arrays
+		{items: uniqueInputsN(0), order: 3, want: `[]`},
+		// Should encode items in order
+		{items: uniqueInputsN(3), order: 3, want: `[{"k":0,"v":0},{"k":1,"v":1},{"k":2,"v":2}]`},
+		// Should round-trip larger trees
+		{items: uniqueInputsN(1000), order: 3},
+		{items: uniqueInputsN(1000), order: 12},
+	}
+
+	for _, c := range cases {
+		b := Bulkload(c.order, c.items)
+		data, err := json.Marshal(b)
+		if err != nil {
+			t.Fatalf("MarshalJSON should not have failed: %v", err)
+		}
+		if c.want != "" && string(data) != c.want {
+			t.Errorf("MarshalJSON should have encoded %s. Got: %s", c.want, data)
+		}
+
+		decoded := New(c.order)
+		decoded.SetItemFactory(decodeJSONTestItem)
+		if err := json.Unmarshal(data, decoded); err != nil {
+			t.Fatalf("UnmarshalJSON should not have failed: %v", err)
+		}
+		checkLoaded(t, decoded, nil, c.items, false)
+	}
+}
+
+func TestMarshalJSONNodes(t *testing.T) {
+	b := Bulkload(3, uniqueInputsN(4))
+	data, err := b.MarshalJSONNodes()
+	if err != nil {
+		t.Fatalf("MarshalJSONNodes should not have failed: %v", err)
+	}
+	want := `{"items":[{"k":1,"v":1}],"children":[{"items":[{"k":0,"v":0}]},{"items":[{"k":2,"v":2},{"k":3,"v":3}]}]}`
+	if string(data) != want {
+		t.Errorf("MarshalJSONNodes should have encoded %s. Got: %s", want, data)
+	}
+}
+
+func TestUnmarshalJSONErrors(t *testing.T) {
+	cases := []struct {
+		data    string
+		tree    *BTree
+		factory ItemFactory
+		wantErr string
+	}{
+		// Should require a factory
+		{data: `[]`, tree: New(3), wantErr: "no item factory"},
+		// Should require an order
+		{data: `[]`, tree: &BTree{}, factory: decodeJSONTestItem, wantErr: "created with New"},
+		{data: `[]`, tree: &BTree{order: 2}, factory: decodeJSONTestItem, wantErr: "at least 3"},
+		// Should reject values other than arrays
+		{data: `{}`, tree: New(3), factory: decodeJSONTestItem, wantErr: "cannot unmarshal"},
+		// Should reject unsorted items
+		{data: `[{"k":2},{"k":1}]`, tree: New(3), factory: decodeJSONTestItem, wantErr: "sorted"},
+		// Should report factory errors
+		{data: `["x"]`, tree: New(3), factory: decodeJSONTestItem, wantErr: "cannot unmarshal"},
+	}
+
+	for _, c := range cases {
+		c.tree.SetItemFactory(c.factory)
+		err := json.Unmarshal([]byte(c.data), c.tree)
+		if err == nil || !strings.Contains(err.Error(), c.wantErr) {
+			t.Errorf("UnmarshalJSON error should contain %q. Got: %v", c.wantErr, err)
+		}
+	}
+}
+
+//=============================================================================
+//= Helpers
+//=============================================================================
+
+// jsonTestItem is the JSON representation of a testItem.
+type jsonTestItem struct {
+	Key int `json:"k"`
+	Val int `json:"v"`
+}
+
+func (ti *testItem) MarshalJSON() ([]byte, error) {
+	return json.Marshal(jsonTestItem{Key: ti.key, Val: ti.val})
+}
+
+// decodeJSONTestItem is an ItemFactory for testItems.
+func decodeJSONTestItem(data json.RawMessage) (Item, error) {
+	var jti jsonTestItem
+	if err := json.Unmarshal(data, &jti); err != nil {
+		return nil, err
+	}
+	return &testItem{key: jti.Key, val: jti.Val}, nil
+}
@@ -0,0 +1,161 @@
+// Package keyenc implements order-preserving encodings of keys.
+//
+// Each Append function appends an encoding of a value to a byte slice, such
+// that the lexicographic order of the encodings, as given by bytes.Compare,
+// matches the order of the values. Appending the columns of a tuple in turn
+// produces a key whose order matches the order of the tuples, compared column
+// by column, so composite keys can be compared without writing a Less method
+// for them. The Desc variants reverse the order of their column.
+//
+// The encodings are not self-describing: keys are only comparable with keys
+// whose columns have the same types and directions.
+package keyenc
+
+import (
+	"encoding/binary"
+	"math"
+	"time"
+)
+
+//=============================================================================
+//= Variables and Constants
+//=============================================================================
+
+// Bytes which encode strings, whose zero bytes are escaped so that the
+// terminator sorts before any byte within the string.
+const (
+	escape     = 0x00
+	escapedNul = 0xFF // Follows escape for a zero byte in the string.
+	terminator = 0x01 // Follows escape at the end of the string.
+)
+
+//=============================================================================
+//= Functions
+//=============================================================================
+
+// AppendUint64 appends an encoding of v, in ascending order, to dst.
+func AppendUint64(dst []byte, v uint64) []byte {
+	return binary.BigEndian.AppendUint64(dst, v)
+}
+
+// AppendUint64Desc appends an encoding of v, in descending order, to dst.
+func AppendUint64Desc(dst []byte, v uint64) []byte {
+	return AppendUint64(dst, ^v)
+}
+
+// AppendInt64 appends an encoding of v, in ascending order, to dst.
+func AppendInt64(dst []byte, v int64) []byte {
+	// Flipping the sign bit orders negative values before positive ones.
+	return AppendUint64(dst, uint64(v)^1<<63)
+}
+
+// AppendInt64Desc appends an encoding of v, in descending order, to dst.
+func AppendInt64Desc(dst []byte, v int64) []byte {
+	return AppendUint64Desc(dst, uint64(v)^1<<63)
+}
+
+// AppendFloat64 appends an encoding of v, in ascending order, to dst.
+//
+// Negative and positive zero are encoded identically, as are all NaNs, which
+// sort after positive infinity.
+func AppendFloat64(dst []byte, v float64) []byte {
+	return AppendUint64(dst, floatBits(v))
+}
+
+// AppendFloat64Desc appends an encoding of v, in descending order, to dst.
+// Values are encoded as by AppendFloat64.
+func AppendFloat64Desc(dst []byte, v float64) []byte {
+	return AppendUint64Desc(dst, floatBits(v))
+}
+
+// AppendString appends an encoding of v, in ascending order, to dst.
+//
+// Unlike the other encodings, which have a fixed length, the encoding of a
+// string is terminated, so that a string sorts before the strings it is a
+// prefix of regardless of the columns which follow it.
+func AppendString(dst []byte, v string) []byte {
+	for i := 0; i < len(v); i++ {
+		if v[i] == escape {
+			dst = append(dst, escape, escapedNul)
+		} else {
+			dst = append(dst, v[i])
+		}
+	}
+	return append(dst, escape, terminator)
+}
+
+// AppendStringDesc appends an encoding of v, in descending order, to dst.
+func AppendStringDesc(dst []byte, v string) []byte {
+	n := len(dst)
+	dst = AppendString(dst, v)
+	invert(dst[n:])
+	return dst
+}
+
+// AppendBytes appends an encoding of v, in ascending order, to dst.
+// It is encoded as by AppendString.
+func AppendBytes(dst, v []byte) []byte {
+	return AppendString(dst, string(v))
+}
+
+// AppendBytesDesc appends an encoding of v, in descending order, to dst.
+// It is encoded as by AppendStringDesc.
+func AppendBytesDesc(dst, v []byte) []byte {
+	return AppendStringDesc(dst, string(v))
+}
+
+// AppendTime appends an encoding of v, in ascending order, to dst.
+//
+// Times are ordered by the instant they represent, so times in different
+// locations are comparable, but the location is not encoded.
+func AppendTime(dst []byte, v time.Time) []byte {
+	dst = AppendInt64(dst, v.Unix())
+	return binary.BigEndian.AppendUint32(dst, uint32(v.Nanosecond()))
+}
+
+// AppendTimeDesc appends an encoding of v, in descending order, to dst.
+func AppendTimeDesc(dst []byte, v time.Time) []byte {
+	n := len(dst)
+	dst = AppendTime(dst, v)
+	invert(dst[n:])
+	return dst
+}
+
+// AppendBool appends an encoding of v, in ascending order, to dst.
+// False sorts before true.
+func AppendBool(dst []byte, v bool) []byte {
+	if v {
+		return append(dst, 1)
+	}
+	return append(dst, 0)
+}
+
+// AppendBoolDesc appends an encoding of v, in descending order, to dst.
+func AppendBoolDesc(dst []byte, v bool) []byte {
+	return AppendBool(dst, !v)
+}
+
+// floatBits returns a bit pattern for v whose unsigned order matches the
+// order of the floats.
+func floatBits(v float64) uint64 {
+	if v == 0 {
+		v = 0 // Normalize negative zero.
+	} else if math.IsNaN(v) {
+		v = math.NaN()
+	}
+	bits := math.Float64bits(v)
+	// Negative floats order in reverse by magnitude, so all their bits are
+	// flipped; positive floats only need to sort after them.
+	if bits&(1<<63) != 0 {
+		return ^bits
+	}
+	return bits | 1<<63
+}
+
+// invert complements every byte of b, which reverses the order of encodings
+// that are not prefixes of one another.
+func invert(b []byte) {
+	for i := range b {
+		b[i] = ^b[i]
+	}
+}
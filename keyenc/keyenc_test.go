@@ -0,0 +1,149 @@
+package keyenc
+
+import (
+	"bytes"
+	"cmp"
+	"math"
+	"math/rand"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestOrder(t *testing.T) {
+	ints := []int64{math.MinInt64, -1 << 40, -256, -1, 0, 1, 255, 256, 1 << 40, math.MaxInt64}
+	uints := []uint64{0, 1, 255, 256, 1 << 63, math.MaxUint64}
+	floats := []float64{math.Inf(-1), -math.MaxFloat64, -1.5, -math.SmallestNonzeroFloat64,
+		0, math.SmallestNonzeroFloat64, 1, 1.5, math.MaxFloat64, math.Inf(1), math.NaN()}
+	strs := []string{"", "\x00", "\x00\x00", "\x00\x01", "\x00\xff", "\x01", "a", "a\x00", "a\x00b",
+		"a\x01", "ab", "b", "\xff", "\xff\xff"}
+	base := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	times := []time.Time{time.Unix(-1<<40, 0), time.Unix(-1, 999999999), time.Unix(0, 0),
+		time.Unix(0, 1), base, base.Add(time.Nanosecond), base.Add(time.Second), time.Unix(1<<40, 0)}
+	bools := []bool{false, true}
+
+	cases := []struct {
+		name string
+		n    int
+		asc  func(dst []byte, i int) []byte
+		desc func(dst []byte, i int) []byte
+	}{
+		// Should order every type as its values are ordered
+		{"int64", len(ints),
+			func(dst []byte, i int) []byte { return AppendInt64(dst, ints[i]) },
+			func(dst []byte, i int) []byte { return AppendInt64Desc(dst, ints[i]) }},
+		{"uint64", len(uints),
+			func(dst []byte, i int) []byte { return AppendUint64(dst, uints[i]) },
+			func(dst []byte, i int) []byte { return AppendUint64Desc(dst, uints[i]) }},
+		{"float64", len(floats),
+			func(dst []byte, i int) []byte { return AppendFloat64(dst, floats[i]) },
+			func(dst []byte, i int) []byte { return AppendFloat64Desc(dst, floats[i]) }},
+		{"string", len(strs),
+			func(dst []byte, i int) []byte { return AppendString(dst, strs[i]) },
+			func(dst []byte, i int) []byte { return AppendStringDesc(dst, strs[i]) }},
+		{"bytes", len(strs),
+			func(dst []byte, i int) []byte { return AppendBytes(dst, []byte(strs[i])) },
+			func(dst []byte, i int) []byte { return AppendBytesDesc(dst, []byte(strs[i])) }},
+		{"time", len(times),
+			func(dst []byte, i int) []byte { return AppendTime(dst, times[i]) },
+			func(dst []byte, i int) []byte { return AppendTimeDesc(dst, times[i]) }},
+		{"bool", len(bools),
+			func(dst []byte, i int) []byte { return AppendBool(dst, bools[i]) },
+			func(dst []byte, i int) []byte { return AppendBoolDesc(dst, bools[i]) }},
+	}
+
+	for _, c := range cases {
+		// Values are listed in ascending order, so the encodings of i and j
+		// must compare as i and j do. A trailing column checks that
+		// variable-length encodings are not confused by what follows them.
+		for i := 0; i < c.n; i++ {
+			for j := 0; j < c.n; j++ {
+				want := cmp.Compare(i, j)
+				a, b := c.asc([]byte("p"), i), c.asc([]byte("p"), j)
+				if got := bytes.Compare(AppendString(a, "\xff"), AppendString(b, "")); i != j && got != want {
+					t.Errorf("%s: ascending encodings of %d and %d should compare %d. Got: %d", c.name, i, j, want, got)
+				}
+				a, b = c.desc([]byte("p"), i), c.desc([]byte("p"), j)
+				if got := bytes.Compare(AppendString(a, "\xff"), AppendString(b, "")); i != j && got != -want {
+					t.Errorf("%s: descending encodings of %d and %d should compare %d. Got: %d", c.name, i, j, -want, got)
+				}
+				// Should encode equal values identically
+				if i == j && !bytes.Equal(a, b) {
+					t.Errorf("%s: encodings of %d should be equal", c.name, i)
+				}
+			}
+		}
+	}
+}
+
+func TestEquivalentValues(t *testing.T) {
+	// Should encode negative and positive zero identically
+	if !bytes.Equal(AppendFloat64(nil, math.Copysign(0, -1)), AppendFloat64(nil, 0)) {
+		t.Errorf("Negative zero should be encoded as zero")
+	}
+	// Should encode all NaNs identically
+	nan := math.Float64frombits(0xFFF8000000000123)
+	if !bytes.Equal(AppendFloat64(nil, nan), AppendFloat64(nil, math.NaN())) {
+		t.Errorf("NaNs should be encoded identically")
+	}
+	// Should encode the same instant in different locations identically
+	now := time.Now()
+	if !bytes.Equal(AppendTime(nil, now), AppendTime(nil, now.In(time.FixedZone("X", 3600)))) {
+		t.Errorf("Times should be encoded by instant")
+	}
+}
+
+func TestTuples(t *testing.T) {
+	type tuple struct {
+		i int64
+		s string
+		f float64
+		b bool
+	}
+	// compare compares tuples with the second and fourth columns descending.
+	compare := func(a, b tuple) int {
+		return cmp.Or(
+			cmp.Compare(a.i, b.i),
+			-strings.Compare(a.s, b.s),
+			cmp.Compare(a.f, b.f),
+			-cmp.Compare(boolInt(a.b), boolInt(b.b)),
+		)
+	}
+	encode := func(v tuple) []byte {
+		key := AppendInt64(nil, v.i)
+		key = AppendStringDesc(key, v.s)
+		key = AppendFloat64(key, v.f)
+		return AppendBoolDesc(key, v.b)
+	}
+
+	strs := []string{"", "a", "a\x00", "ab", "b"}
+	tuples := make([]tuple, 500)
+	for i := range tuples {
+		tuples[i] = tuple{
+			i: int64(rand.Intn(5) - 2),
+			s: strs[rand.Intn(len(strs))],
+			f: float64(rand.Intn(5)-2) / 2,
+			b: rand.Intn(2) == 0,
+		}
+	}
+	// Should order keys of multiple columns as their tuples
+	for _, a := range tuples[:50] {
+		for _, b := range tuples {
+			if want, got := compare(a, b), bytes.Compare(encode(a), encode(b)); got != want {
+				t.Fatalf("Keys of %v and %v should compare %d. Got: %d", a, b, want, got)
+			}
+		}
+	}
+}
+
+//=============================================================================
+//= Helpers
+//=============================================================================
+
+// boolInt returns 1 if b is true, and 0 otherwise.
+func boolInt(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
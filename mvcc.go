@@ -0,0 +1,189 @@
+package btree
+
+import (
+	"sync"
+)
+
+//=============================================================================
+//= Types
+//=============================================================================
+
+// An MVCC is a B-Tree with multi-version concurrency control.
+//
+// Every change produces a new version of the tree, and a Snapshot pins a
+// version so that it can be read consistently while writers continue. The
+// tree is persistent: changes copy the nodes they modify rather than
+// modifying them in place, so versions share all unchanged nodes, and a
+// version's nodes are reclaimed once no Snapshot references it.
+//
+// An MVCC is safe for concurrent use. Writers are serialized, while reads of
+// Snapshots do not block and are not blocked.
+type MVCC struct {
+	mu      sync.Mutex // Guards the fields below.
+	order   int
+	root    *cowNode
+	count   int
+	version uint64
+	pinned  map[uint64]int // Number of open Snapshots of each version.
+}
+
+// A Snapshot is a read-only view of a version of an MVCC.
+type Snapshot struct {
+	mvcc    *MVCC
+	version uint64
+	root    *cowNode
+	count   int
+}
+
+// A SnapshotIterator is a stateful iterator over a Snapshot.
+type SnapshotIterator struct {
+	cowIterator
+}
+
+//=============================================================================
+//= Methods
+//=============================================================================
+
+// Insert inserts an item into a new version of the tree.
+//
+// If the item is already in the tree, no new version is produced.
+func (m *MVCC) Insert(item Item) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if root, ok := cowInsert(m.root, m.order, item); ok {
+		m.root = root
+		m.count++
+		m.version++
+	}
+}
+
+// Delete deletes an item from a new version of the tree.
+//
+// If the item is not in the tree, no new version is produced.
+func (m *MVCC) Delete(item Item) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if root, ok := cowDelete(m.root, m.order, item); ok {
+		m.root = root
+		m.count--
+		m.version++
+	}
+}
+
+// Search searches for an item in the current version of the tree.
+//
+// If the item is found, the method returns it and true.
+// Otherwise, the function returns nil and false.
+func (m *MVCC) Search(item Item) (Item, bool) {
+	m.mu.Lock()
+	root := m.root
+	m.mu.Unlock()
+	return root.search(item)
+}
+
+// Len returns the number of items in the current version of the tree.
+func (m *MVCC) Len() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.count
+}
+
+// Version returns the current version number of the tree.
+// Version numbers start at zero and increase with every change.
+func (m *MVCC) Version() uint64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.version
+}
+
+// Snapshot returns a Snapshot pinned to the current version of the tree.
+// The Snapshot must be released with Release once it is no longer needed.
+func (m *MVCC) Snapshot() *Snapshot {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.pinned[m.version]++
+	return &Snapshot{mvcc: m, version: m.version, root: m.root, count: m.count}
+}
+
+// Oldest returns the oldest version of the tree which is still retained,
+// which is either the oldest version pinned by a Snapshot or the current
+// version.
+func (m *MVCC) Oldest() uint64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	oldest := m.version
+	for v := range m.pinned {
+		if v < oldest {
+			oldest = v
+		}
+	}
+	return oldest
+}
+
+// Version returns the version of the tree the Snapshot is pinned to.
+func (s *Snapshot) Version() uint64 {
+	return s.version
+}
+
+// Len returns the number of items in the Snapshot.
+func (s *Snapshot) Len() int {
+	return s.count
+}
+
+// Search searches for an item in the Snapshot.
+//
+// If the item is found, the method returns it and true.
+// Otherwise, the function returns nil and false.
+func (s *Snapshot) Search(item Item) (Item, bool) {
+	return s.root.search(item)
+}
+
+// NewIterator returns a new iterator over the Snapshot.
+func (s *Snapshot) NewIterator() *SnapshotIterator {
+	return &SnapshotIterator{*newCowIterator(s.root, forward)}
+}
+
+// NewReverseIterator returns a new reverse iterator over the Snapshot.
+func (s *Snapshot) NewReverseIterator() *SnapshotIterator {
+	return &SnapshotIterator{*newCowIterator(s.root, reverse)}
+}
+
+// Release unpins the Snapshot's version, allowing it to be reclaimed once no
+// other Snapshot references it. The Snapshot must not be used afterwards,
+// though iterators created from it remain valid.
+//
+// Releasing a Snapshot more than once has no effect.
+func (s *Snapshot) Release() {
+	if s.mvcc == nil {
+		return
+	}
+	m := s.mvcc
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.pinned[s.version]--; m.pinned[s.version] == 0 {
+		delete(m.pinned, s.version)
+	}
+	s.mvcc, s.root, s.count = nil, nil, 0
+}
+
+// HasNext determines if iterator can iterate.
+func (si *SnapshotIterator) HasNext() bool {
+	return si.hasNext()
+}
+
+// Next moves the iterator forward and returns its previous value.
+func (si *SnapshotIterator) Next() (Item, error) {
+	if !si.HasNext() {
+		return nil, ErrIteratorExhausted
+	}
+	return si.next(), nil
+}
+
+//=============================================================================
+//= Functions
+//=============================================================================
+
+// NewMVCC returns an empty MVCC tree of the given order.
+func NewMVCC(order int) *MVCC {
+	return &MVCC{order: order, pinned: make(map[uint64]int)}
+}
@@ -0,0 +1,207 @@
+package btree
+
+import (
+	"math/rand"
+	"sync"
+	"testing"
+)
+
+func TestMVCC(t *testing.T) {
+	for _, order := range []int{3, 4, 5, 8} {
+		m := NewMVCC(order)
+		model := make(map[int]int)
+		type pinned struct {
+			snap *Snapshot
+			want map[int]int
+		}
+		var snaps []pinned
+
+		for i := 0; i < 3000; i++ {
+			key := rand.Intn(500)
+			version := m.Version()
+			_, present := model[key]
+			insert := rand.Intn(3) > 0
+			if insert {
+				m.Insert(&testItem{key: key, val: i})
+				if !present {
+					model[key] = i
+				}
+			} else {
+				m.Delete(&testItem{key: key})
+				delete(model, key)
+			}
+			// Only changes should produce new versions
+			if changed := insert != present; changed && m.Version() != version+1 {
+				t.Fatalf("Change should have produced a new version")
+			} else if !changed && m.Version() != version {
+				t.Fatalf("Ignored change should not have produced a new version")
+			}
+
+			if i%300 == 0 {
+				want := make(map[int]int, len(model))
+				for k, v := range model {
+					want[k] = v
+				}
+				snaps = append(snaps, pinned{snap: m.Snapshot(), want: want})
+			}
+		}
+		checkCowTree(t, m.root, order)
+		current := m.Snapshot()
+		checkSnapshot(t, current, model)
+		current.Release()
+
+		// Snapshots should be unaffected by later changes
+		for _, p := range snaps {
+			checkCowTree(t, p.snap.root, order)
+			checkSnapshot(t, p.snap, p.want)
+		}
+
+		// Versions should be retained until their Snapshots are released
+		if m.Oldest() != snaps[0].snap.Version() {
+			t.Errorf("Oldest should be the first pinned version %d. Got: %d", snaps[0].snap.Version(), m.Oldest())
+		}
+		for _, p := range snaps {
+			p.snap.Release()
+			p.snap.Release()
+		}
+		if m.Oldest() != m.Version() {
+			t.Errorf("Oldest should be the current version once Snapshots are released. Got: %d", m.Oldest())
+		}
+	}
+}
+
+func TestMVCCConcurrent(t *testing.T) {
+	m := NewMVCC(4)
+	for i := 0; i < 100; i++ {
+		m.Insert(&testItem{key: i})
+	}
+
+	// Readers should see consistent Snapshots while a writer changes the
+	// tree: the writer keeps the keys 0 to 99 present, and each Snapshot
+	// must hold them in order.
+	var wg sync.WaitGroup
+	stop := make(chan struct{})
+	for r := 0; r < 4; r++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				snap := m.Snapshot()
+				prev, n := -1, 0
+				for iter := snap.NewIterator(); iter.HasNext(); n++ {
+					next, _ := iter.Next()
+					if key := next.(*testItem).key; key <= prev {
+						t.Errorf("Snapshot iteration should be in order. Got %d after %d", key, prev)
+					} else {
+						prev = key
+					}
+				}
+				if n != snap.Len() {
+					t.Errorf("Snapshot iteration should return %d items. Got: %d", snap.Len(), n)
+				}
+				snap.Release()
+			}
+		}()
+	}
+	for i := 0; i < 5000; i++ {
+		key := 100 + rand.Intn(200)
+		if i%2 == 0 {
+			m.Insert(&testItem{key: key})
+		} else {
+			m.Delete(&testItem{key: key})
+		}
+	}
+	close(stop)
+	wg.Wait()
+}
+
+//=============================================================================
+//= Helpers
+//=============================================================================
+
+// checkSnapshot checks that a Snapshot holds exactly the items in want,
+// which maps keys to values.
+func checkSnapshot(t *testing.T, snap *Snapshot, want map[int]int) {
+	t.Helper()
+	if snap.Len() != len(want) {
+		t.Fatalf("Snapshot should contain %d items. Got: %d", len(want), snap.Len())
+	}
+	for k, v := range want {
+		found, ok := snap.Search(&testItem{key: k})
+		if !ok || found.(*testItem).val != v {
+			t.Fatalf("Snapshot should contain key %d with value %d. Got: %v", k, v, found)
+		}
+	}
+	keys := sortedKeys(want)
+	iter := snap.NewIterator()
+	for _, k := range keys {
+		next, err := iter.Next()
+		if err != nil || next.(*testItem).key != k {
+			t.Fatalf("Snapshot iterator should have returned key %d. Got: %v, error: %v", k, next, err)
+		}
+	}
+	if _, err := iter.Next(); err == nil {
+		t.Fatalf("Next should have failed on an exhausted iterator")
+	}
+	iter = snap.NewReverseIterator()
+	for i := len(keys) - 1; i >= 0; i-- {
+		next, err := iter.Next()
+		if err != nil || next.(*testItem).key != keys[i] {
+			t.Fatalf("Snapshot reverse iterator should have returned key %d. Got: %v, error: %v", keys[i], next, err)
+		}
+	}
+	if iter.HasNext() {
+		t.Fatalf("Snapshot reverse iterator should no longer have next")
+	}
+}
+
+// checkCowTree checks that a persistent B-Tree satisfies the B-Tree
+// invariants.
+func checkCowTree(t *testing.T, root *cowNode, order int) {
+	t.Helper()
+	minItems := (order+1)/2 - 1
+	leafDepth := -1
+	var walk func(n *cowNode, depth int, lo, hi Item)
+	walk = func(n *cowNode, depth int, lo, hi Item) {
+		if n != root && len(n.items) < minItems {
+			t.Fatalf("Node has too few items: %d", len(n.items))
+		}
+		if len(n.items) == 0 || len(n.items) > order-1 {
+			t.Fatalf("Node has an invalid number of items: %d", len(n.items))
+		}
+		for i, item := range n.items {
+			if (i > 0 && !n.items[i-1].Less(item)) || (lo != nil && !lo.Less(item)) || (hi != nil && !item.Less(hi)) {
+				t.Fatalf("Node has out of order item %v", item)
+			}
+		}
+		if len(n.children) == 0 {
+			if leafDepth == -1 {
+				leafDepth = depth
+			} else if depth != leafDepth {
+				t.Fatalf("Leaf is at depth %d, other leaves are at %d", depth, leafDepth)
+			}
+			return
+		}
+		if len(n.children) != len(n.items)+1 {
+			t.Fatalf("Node has %d children but %d items", len(n.children), len(n.items))
+		}
+		for i, c := range n.children {
+			childLo, childHi := lo, hi
+			if i > 0 {
+				childLo = n.items[i-1]
+			}
+			if i < len(n.items) {
+				childHi = n.items[i]
+			}
+			walk(c, depth+1, childLo, childHi)
+		}
+	}
+	if root != nil {
+		walk(root, 0, nil, nil)
+	}
+}
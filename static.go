@@ -0,0 +1,484 @@
+package btree
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+//=============================================================================
+//= Variables and Constants
+//=============================================================================
+
+// Static file format identifiers.
+const (
+	staticMagic   = "BTST"
+	staticVersion = 1
+)
+
+// Size of the static file header, which occupies the file's first page.
+const staticHeaderSize = 4 + 1 + 4 + 4 + 8 + 8 + 4
+
+// Size of the fixed part of a static data page, holding its entry count.
+const staticPageHeaderSize = 2
+
+//=============================================================================
+//= Types
+//=============================================================================
+
+// A StaticBuilder writes an immutable tree file which can be served by
+// OpenStatic.
+//
+// Entries are added in ascending key order and packed into fixed-size data
+// pages. Once all entries are added, Finish writes a separator index holding
+// the first key of every page.
+type StaticBuilder struct {
+	path     string
+	file     *os.File
+	w        *bufio.Writer
+	pageSize int
+
+	page      []byte   // Entries of the page being built.
+	offsets   []int    // Offsets of the entries within page.
+	firstKeys [][]byte // First key of every completed page.
+	last      []byte   // Most recently added key.
+	hasLast   bool     // Whether any key has been added, as last may be empty.
+	count     int      // Number of entries added.
+}
+
+// A StaticTree is a read-only tree of byte keys and values, served directly
+// from a memory-mapped file written by a StaticBuilder.
+//
+// Keys are compared with bytes.Compare. Key and value slices returned by a
+// StaticTree refer to the mapped file, so they must not be modified and are
+// only valid until the tree is closed.
+type StaticTree struct {
+	data     []byte
+	unmap    func() error
+	pageSize int
+	numPages int
+	count    int
+	index    []byte // Offsets of each page's first key, followed by the keys.
+}
+
+// A StaticIterator is a stateful iterator over a range of a StaticTree.
+type StaticIterator struct {
+	tree  *StaticTree
+	page  int
+	entry int
+	hi    []byte // Exclusive upper bound, or nil if unbounded.
+}
+
+//=============================================================================
+//= Methods
+//=============================================================================
+
+// Add adds an entry to the tree being built.
+//
+// Keys must be added in strictly ascending order, and each entry must fit in
+// a single page.
+func (b *StaticBuilder) Add(key, value []byte) error {
+	if b.hasLast && bytes.Compare(b.last, key) >= 0 {
+		return errors.New("keys must be added in strictly ascending order")
+	}
+	entry := binary.AppendUvarint(nil, uint64(len(key)))
+	entry = append(entry, key...)
+	entry = binary.AppendUvarint(entry, uint64(len(value)))
+	entry = append(entry, value...)
+	if staticPageHeaderSize+2+len(entry) > b.pageSize {
+		return fmt.Errorf("entry of %d bytes does not fit in a page", len(entry))
+	}
+
+	if staticPageHeaderSize+2*(len(b.offsets)+1)+len(b.page)+len(entry) > b.pageSize {
+		if err := b.flushPage(); err != nil {
+			return err
+		}
+	}
+	if len(b.offsets) == 0 {
+		b.firstKeys = append(b.firstKeys, append([]byte(nil), key...))
+	}
+	b.offsets = append(b.offsets, len(b.page))
+	b.page = append(b.page, entry...)
+	b.last, b.hasLast = append(b.last[:0], key...), true
+	b.count++
+	return nil
+}
+
+// Finish writes the separator index and header, and atomically moves the
+// completed file into place.
+func (b *StaticBuilder) Finish() error {
+	err := b.finish()
+	if cerr := b.file.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(b.file.Name(), b.path)
+	}
+	if err != nil {
+		os.Remove(b.file.Name())
+	}
+	return err
+}
+
+// finish writes the remainder of the file.
+func (b *StaticBuilder) finish() error {
+	if len(b.offsets) > 0 {
+		if err := b.flushPage(); err != nil {
+			return err
+		}
+	}
+
+	// The index holds the offset of each page's first key, relative to
+	// the start of the index, followed by the keys themselves.
+	keysStart := 4 * len(b.firstKeys)
+	var offsets, keys []byte
+	for _, k := range b.firstKeys {
+		offsets = binary.BigEndian.AppendUint32(offsets, uint32(keysStart+len(keys)))
+		keys = binary.AppendUvarint(keys, uint64(len(k)))
+		keys = append(keys, k...)
+	}
+	if _, err := b.w.Write(offsets); err != nil {
+		return err
+	}
+	if _, err := b.w.Write(keys); err != nil {
+		return err
+	}
+	if err := b.w.Flush(); err != nil {
+		return err
+	}
+
+	header := make([]byte, 0, staticHeaderSize)
+	header = append(header, staticMagic...)
+	header = append(header, staticVersion)
+	header = binary.BigEndian.AppendUint32(header, uint32(b.pageSize))
+	header = binary.BigEndian.AppendUint32(header, uint32(len(b.firstKeys)))
+	header = binary.BigEndian.AppendUint64(header, uint64(b.count))
+	header = binary.BigEndian.AppendUint64(header, uint64(len(offsets)+len(keys)))
+	header = binary.BigEndian.AppendUint32(header, crc32.ChecksumIEEE(header))
+	if _, err := b.file.WriteAt(header, 0); err != nil {
+		return err
+	}
+	return b.file.Sync()
+}
+
+// flushPage writes the page being built to the file.
+func (b *StaticBuilder) flushPage() error {
+	page := make([]byte, b.pageSize)
+	binary.BigEndian.PutUint16(page, uint16(len(b.offsets)))
+	entriesStart := staticPageHeaderSize + 2*len(b.offsets)
+	for i, off := range b.offsets {
+		binary.BigEndian.PutUint16(page[staticPageHeaderSize+2*i:], uint16(entriesStart+off))
+	}
+	copy(page[entriesStart:], b.page)
+	if _, err := b.w.Write(page); err != nil {
+		return err
+	}
+	b.page, b.offsets = b.page[:0], b.offsets[:0]
+	return nil
+}
+
+// Len returns the number of entries in the StaticTree.
+func (s *StaticTree) Len() int {
+	return s.count
+}
+
+// Search returns the value stored for key.
+// If the key is not in the tree, the method returns nil and false.
+func (s *StaticTree) Search(key []byte) ([]byte, bool) {
+	page, entry := s.seek(key)
+	if page == s.numPages {
+		return nil, false
+	}
+	k, v := s.entry(page, entry)
+	if !bytes.Equal(k, key) {
+		return nil, false
+	}
+	return v, true
+}
+
+// Floor returns the entry with the largest key less than or equal to key.
+// If there is no such entry, ok is false.
+func (s *StaticTree) Floor(key []byte) (k, v []byte, ok bool) {
+	page, entry := s.seek(key)
+	if page < s.numPages {
+		if k, v := s.entry(page, entry); bytes.Equal(k, key) {
+			return k, v, true
+		}
+	}
+	// The entry before the ceiling is the floor.
+	if entry > 0 {
+		entry--
+	} else if page > 0 {
+		page--
+		entry = s.pageLen(page) - 1
+	} else {
+		return nil, nil, false
+	}
+	k, v = s.entry(page, entry)
+	return k, v, true
+}
+
+// Ceiling returns the entry with the smallest key greater than or equal to
+// key. If there is no such entry, ok is false.
+func (s *StaticTree) Ceiling(key []byte) (k, v []byte, ok bool) {
+	page, entry := s.seek(key)
+	if page == s.numPages {
+		return nil, nil, false
+	}
+	k, v = s.entry(page, entry)
+	return k, v, true
+}
+
+// Range returns an iterator over the entries with keys in the range
+// [lo, hi), in ascending order. A nil bound leaves that end of the range
+// unbounded.
+func (s *StaticTree) Range(lo, hi []byte) *StaticIterator {
+	it := &StaticIterator{tree: s, hi: hi}
+	if lo != nil {
+		it.page, it.entry = s.seek(lo)
+	}
+	return it
+}
+
+// Close unmaps the tree's file. Slices returned by the tree must not be used
+// afterwards.
+func (s *StaticTree) Close() error {
+	s.data = nil
+	return s.unmap()
+}
+
+// seek returns the position of the first entry with a key greater than or
+// equal to key. If there is no such entry, the page is s.numPages.
+func (s *StaticTree) seek(key []byte) (int, int) {
+	// Find the last page whose first key is not greater than key.
+	page := sort.Search(s.numPages, func(i int) bool {
+		return bytes.Compare(s.firstKey(i), key) > 0
+	}) - 1
+	if page < 0 {
+		return 0, 0
+	}
+	n := s.pageLen(page)
+	entry := sort.Search(n, func(i int) bool {
+		k, _ := s.entry(page, i)
+		return bytes.Compare(k, key) >= 0
+	})
+	if entry == n {
+		return page + 1, 0
+	}
+	return page, entry
+}
+
+// firstKey returns the first key of a page from the separator index.
+func (s *StaticTree) firstKey(page int) []byte {
+	off := binary.BigEndian.Uint32(s.index[4*page:])
+	key, _, _ := readUvarintBytes(s.index[off:])
+	return key
+}
+
+// check validates the separator index and every data page, so that the
+// offsets and lengths read by the other methods are within bounds.
+func (s *StaticTree) check() error {
+	if 4*s.numPages > len(s.index) {
+		return errors.New("static tree index is corrupt")
+	}
+	for page := 0; page < s.numPages; page++ {
+		off := binary.BigEndian.Uint32(s.index[4*page:])
+		if int64(off) >= int64(len(s.index)) {
+			return errors.New("static tree index is corrupt")
+		}
+		if _, _, ok := readUvarintBytes(s.index[off:]); !ok {
+			return errors.New("static tree index is corrupt")
+		}
+		if err := s.checkPage(page); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkPage validates the entry offsets and lengths of a data page. Pages
+// written by a StaticBuilder hold at least one entry.
+func (s *StaticTree) checkPage(page int) error {
+	data := s.pageData(page)
+	n := s.pageLen(page)
+	entriesStart := staticPageHeaderSize + 2*n
+	if n == 0 || entriesStart > len(data) {
+		return fmt.Errorf("static tree page %d is corrupt", page)
+	}
+	for i := 0; i < n; i++ {
+		off := int(binary.BigEndian.Uint16(data[staticPageHeaderSize+2*i:]))
+		if off < entriesStart || off >= len(data) {
+			return fmt.Errorf("static tree page %d is corrupt", page)
+		}
+		_, rest, ok := readUvarintBytes(data[off:])
+		if ok {
+			_, _, ok = readUvarintBytes(rest)
+		}
+		if !ok {
+			return fmt.Errorf("static tree page %d is corrupt", page)
+		}
+	}
+	return nil
+}
+
+// pageData returns the contents of a data page.
+func (s *StaticTree) pageData(page int) []byte {
+	start := (page + 1) * s.pageSize
+	return s.data[start : start+s.pageSize]
+}
+
+// pageLen returns the number of entries in a data page.
+func (s *StaticTree) pageLen(page int) int {
+	return int(binary.BigEndian.Uint16(s.pageData(page)))
+}
+
+// entry returns the key and value of an entry in a data page.
+func (s *StaticTree) entry(page, entry int) ([]byte, []byte) {
+	data := s.pageData(page)
+	off := binary.BigEndian.Uint16(data[staticPageHeaderSize+2*entry:])
+	key, rest, _ := readUvarintBytes(data[off:])
+	value, _, _ := readUvarintBytes(rest)
+	return key, value
+}
+
+// HasNext determines if iterator can iterate.
+func (it *StaticIterator) HasNext() bool {
+	if it.page >= it.tree.numPages {
+		return false
+	}
+	if it.hi == nil {
+		return true
+	}
+	k, _ := it.tree.entry(it.page, it.entry)
+	return bytes.Compare(k, it.hi) < 0
+}
+
+// Next moves the iterator forward and returns the entry it was positioned
+// at.
+func (it *StaticIterator) Next() (key, value []byte, err error) {
+	if !it.HasNext() {
+		return nil, nil, ErrIteratorExhausted
+	}
+	key, value = it.tree.entry(it.page, it.entry)
+	it.entry++
+	if it.entry == it.tree.pageLen(it.page) {
+		it.page++
+		it.entry = 0
+	}
+	return key, value, nil
+}
+
+//=============================================================================
+//= Functions
+//=============================================================================
+
+// NewStaticBuilder returns a StaticBuilder which writes a tree with pages of
+// pageSize bytes to the file at path. The file is only created once Finish
+// succeeds.
+func NewStaticBuilder(path string, pageSize int) (*StaticBuilder, error) {
+	if pageSize < staticHeaderSize || pageSize > 1<<16 {
+		return nil, fmt.Errorf("static page size must be between %d and %d", staticHeaderSize, 1<<16)
+	}
+	file, err := os.CreateTemp(filepath.Dir(path), ".static-*")
+	if err != nil {
+		return nil, err
+	}
+	b := &StaticBuilder{
+		path:     path,
+		file:     file,
+		w:        bufio.NewWriter(file),
+		pageSize: pageSize,
+	}
+	// The header page is written last, once its contents are known.
+	if _, err := b.w.Write(make([]byte, pageSize)); err != nil {
+		file.Close()
+		os.Remove(file.Name())
+		return nil, err
+	}
+	return b, nil
+}
+
+// OpenStatic memory-maps the tree file at path, which must have been written
+// by a StaticBuilder.
+//
+// The offsets and lengths in every page are validated when the file is
+// opened, so a truncated or corrupted file is reported as an error rather
+// than causing a panic later. Opening a tree therefore reads the whole file.
+// Only the header is checksummed, so a corrupted key or value of a valid
+// length is not detected.
+func OpenStatic(path string) (*StaticTree, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+	if info.Size() < staticHeaderSize {
+		return nil, errors.New("file is not a static tree")
+	}
+	data, unmap, err := mmapFile(file, int(info.Size()))
+	if err != nil {
+		return nil, err
+	}
+
+	s, err := newStaticTree(data)
+	if err != nil {
+		unmap()
+		return nil, err
+	}
+	s.unmap = unmap
+	return s, nil
+}
+
+// newStaticTree validates the header of a static tree file and returns a
+// StaticTree serving its contents.
+func newStaticTree(data []byte) (*StaticTree, error) {
+	sumPos := staticHeaderSize - crc32.Size
+	if string(data[:len(staticMagic)]) != staticMagic ||
+		crc32.ChecksumIEEE(data[:sumPos]) != binary.BigEndian.Uint32(data[sumPos:]) {
+		return nil, errors.New("file is not a static tree or its header is corrupt")
+	}
+	if v := data[len(staticMagic)]; v != staticVersion {
+		return nil, fmt.Errorf("unsupported static tree version %d", v)
+	}
+	pos := len(staticMagic) + 1
+	s := &StaticTree{
+		data:     data,
+		pageSize: int(binary.BigEndian.Uint32(data[pos:])),
+		numPages: int(binary.BigEndian.Uint32(data[pos+4:])),
+		count:    int(binary.BigEndian.Uint64(data[pos+8:])),
+	}
+	if s.pageSize < staticHeaderSize || s.pageSize > 1<<16 {
+		return nil, errors.New("static tree header is corrupt")
+	}
+	indexLen := binary.BigEndian.Uint64(data[pos+16:])
+	indexStart := uint64(s.numPages+1) * uint64(s.pageSize)
+	if indexStart+indexLen != uint64(len(data)) {
+		return nil, errors.New("static tree file is truncated or corrupt")
+	}
+	s.index = data[indexStart:]
+	if err := s.check(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// readUvarintBytes reads a uvarint length-prefixed byte string from data,
+// returning it and the remainder of data. If the string does not fit in data,
+// ok is false.
+func readUvarintBytes(data []byte) (b, rest []byte, ok bool) {
+	n, w := binary.Uvarint(data)
+	if w <= 0 || n > uint64(len(data)-w) {
+		return nil, nil, false
+	}
+	return data[w : w+int(n)], data[w+int(n):], true
+}
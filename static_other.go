@@ -0,0 +1,22 @@
+//go:build !unix
+
+package btree
+
+import (
+	"io"
+	"os"
+)
+
+//=============================================================================
+//= Functions
+//=============================================================================
+
+// mmapFile reads the first size bytes of file into memory, on platforms where
+// memory-mapping is not supported.
+func mmapFile(file *os.File, size int) ([]byte, func() error, error) {
+	data := make([]byte, size)
+	if _, err := io.ReadFull(file, data); err != nil {
+		return nil, nil, err
+	}
+	return data, func() error { return nil }, nil
+}
@@ -0,0 +1,188 @@
+package btree
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestStaticTree(t *testing.T) {
+	cases := []struct {
+		n        int
+		pageSize int
+	}{
+		// Should work with an empty tree
+		{n: 0, pageSize: 256},
+		// Should work with a single page
+		{n: 5, pageSize: 256},
+		// Should work with many small pages
+		{n: 2000, pageSize: 64},
+		{n: 2000, pageSize: 4096},
+	}
+
+	for _, c := range cases {
+		path := filepath.Join(t.TempDir(), "static")
+		b, err := NewStaticBuilder(path, c.pageSize)
+		if err != nil {
+			t.Fatalf("NewStaticBuilder should not have failed: %v", err)
+		}
+		// Keys are the even numbers, so odd numbers fall between them.
+		for i := 0; i < c.n; i++ {
+			if err := b.Add(staticKey(2*i), []byte(fmt.Sprint(i))); err != nil {
+				t.Fatalf("Add should not have failed: %v", err)
+			}
+		}
+		if err := b.Finish(); err != nil {
+			t.Fatalf("Finish should not have failed: %v", err)
+		}
+		s, err := OpenStatic(path)
+		if err != nil {
+			t.Fatalf("OpenStatic should not have failed: %v", err)
+		}
+		if s.Len() != c.n {
+			t.Errorf("StaticTree should contain %d entries. Got: %d", c.n, s.Len())
+		}
+
+		for i := -1; i <= 2*c.n; i++ {
+			key := staticKey(i)
+			v, ok := s.Search(key)
+			if present := i >= 0 && i%2 == 0 && i < 2*c.n; ok != present || (ok && string(v) != fmt.Sprint(i/2)) {
+				t.Fatalf("Search(%d) should have returned %v. Got: %q, %v", i, present, v, ok)
+			}
+
+			floor := i
+			if i%2 != 0 {
+				floor = i - 1
+			}
+			k, _, ok := s.Floor(key)
+			if floor < 0 || c.n == 0 {
+				if ok {
+					t.Fatalf("Floor(%d) should not have found an entry. Got: %q", i, k)
+				}
+			} else if !ok || !bytes.Equal(k, staticKey(min(floor, 2*c.n-2))) {
+				t.Fatalf("Floor(%d) should have returned %d. Got: %q, %v", i, floor, k, ok)
+			}
+
+			ceiling := max(i+i%2, 0)
+			k, _, ok = s.Ceiling(key)
+			if ceiling >= 2*c.n {
+				if ok {
+					t.Fatalf("Ceiling(%d) should not have found an entry. Got: %q", i, k)
+				}
+			} else if !ok || !bytes.Equal(k, staticKey(ceiling)) {
+				t.Fatalf("Ceiling(%d) should have returned %d. Got: %q, %v", i, ceiling, k, ok)
+			}
+		}
+
+		// Should iterate over bounded and unbounded ranges
+		ranges := []struct {
+			lo, hi   []byte
+			from, to int
+		}{
+			{lo: nil, hi: nil, from: 0, to: c.n},
+			{lo: staticKey(3), hi: staticKey(2 * (c.n / 2)), from: 2, to: c.n / 2},
+			{lo: staticKey(2 * c.n), hi: nil, from: c.n, to: c.n},
+		}
+		for _, r := range ranges {
+			iter := s.Range(r.lo, r.hi)
+			for i := r.from; i < r.to; i++ {
+				k, v, err := iter.Next()
+				if err != nil || !bytes.Equal(k, staticKey(2*i)) || string(v) != fmt.Sprint(i) {
+					t.Fatalf("Range iterator should have returned entry %d. Got: %q, %q, error: %v", i, k, v, err)
+				}
+			}
+			if iter.HasNext() {
+				t.Fatalf("Range iterator should no longer have next")
+			}
+			if _, _, err := iter.Next(); err == nil {
+				t.Fatalf("Next should have failed on an exhausted iterator")
+			}
+		}
+
+		if err := s.Close(); err != nil {
+			t.Errorf("Close should not have failed: %v", err)
+		}
+	}
+}
+
+func TestStaticErrors(t *testing.T) {
+	dir := t.TempDir()
+
+	// Should reject invalid page sizes
+	if _, err := NewStaticBuilder(filepath.Join(dir, "a"), 8); err == nil {
+		t.Errorf("NewStaticBuilder should have rejected a tiny page size")
+	}
+
+	b, err := NewStaticBuilder(filepath.Join(dir, "b"), 64)
+	if err != nil {
+		t.Fatalf("NewStaticBuilder should not have failed: %v", err)
+	}
+	// Should reject entries which do not fit in a page
+	if err := b.Add([]byte("k"), make([]byte, 64)); err == nil {
+		t.Errorf("Add of oversized entry should have failed")
+	}
+	// Should reject keys out of order, including duplicates
+	b.Add([]byte("b"), nil)
+	for _, key := range []string{"a", "b"} {
+		if err := b.Add([]byte(key), nil); err == nil {
+			t.Errorf("Add of key %q after \"b\" should have failed", key)
+		}
+	}
+	if err := b.Finish(); err != nil {
+		t.Fatalf("Finish should not have failed: %v", err)
+	}
+
+	// Should reject a duplicate empty key
+	e, _ := NewStaticBuilder(filepath.Join(dir, "e"), 64)
+	if err := e.Add(nil, nil); err != nil {
+		t.Errorf("Add of empty key should not have failed: %v", err)
+	}
+	if err := e.Add([]byte{}, nil); err == nil {
+		t.Errorf("Add of second empty key should have failed")
+	}
+	e.Finish()
+
+	// Should reject files which are not static trees, or are corrupt
+	data, _ := os.ReadFile(filepath.Join(dir, "b"))
+	corrupt := append([]byte(nil), data...)
+	corrupt[6] ^= 0xFF
+	// The file's only data page is its second, holding the entry count,
+	// the entry's offset, and then the entry itself.
+	patch := func(off int, b ...byte) []byte {
+		patched := append([]byte(nil), data...)
+		copy(patched[off:], b)
+		return patched
+	}
+	files := map[string][]byte{
+		"garbage":      []byte(strings.Repeat("x", 256)),
+		"short":        []byte("BTST"),
+		"corrupt":      corrupt,
+		"truncated":    data[:len(data)-1],
+		"empty page":   patch(64, 0, 0),
+		"page count":   patch(64, 0xFF, 0xFF),
+		"entry offset": patch(66, 0xFF, 0xFF),
+		"key length":   patch(68, 0x7F),
+		"value length": patch(70, 0x7F),
+		"uvarint":      patch(68, 0xFF, 0xFF, 0xFF),
+	}
+	for name, contents := range files {
+		path := filepath.Join(dir, name)
+		os.WriteFile(path, contents, 0644)
+		if s, err := OpenStatic(path); err == nil {
+			s.Close()
+			t.Errorf("OpenStatic should have rejected the %s file", name)
+		}
+	}
+}
+
+//=============================================================================
+//= Helpers
+//=============================================================================
+
+// staticKey returns a byte-comparable key for i, which must be at least -1.
+func staticKey(i int) []byte {
+	return []byte(fmt.Sprintf("key%08d", i+1))
+}
@@ -0,0 +1,22 @@
+//go:build unix
+
+package btree
+
+import (
+	"os"
+	"syscall"
+)
+
+//=============================================================================
+//= Functions
+//=============================================================================
+
+// mmapFile maps the first size bytes of file read-only into memory, returning
+// the mapping and a function which unmaps it.
+func mmapFile(file *os.File, size int) ([]byte, func() error, error) {
+	data, err := syscall.Mmap(int(file.Fd()), 0, size, syscall.PROT_READ, syscall.MAP_SHARED)
+	if err != nil {
+		return nil, nil, err
+	}
+	return data, func() error { return syscall.Munmap(data) }, nil
+}
@@ -0,0 +1,77 @@
+package btree
+
+import "unsafe"
+
+//=============================================================================
+//= Types
+//=============================================================================
+
+// Stats describes the shape and size of a BTree.
+type Stats struct {
+	Height int // Number of levels in the tree, including the root.
+	Nodes  int // Total number of nodes.
+	Leaves int // Number of leaf nodes.
+	Items  int // Total number of items.
+
+	// Levels holds per-level statistics, starting with the root.
+	Levels []LevelStats
+
+	// MemoryBytes estimates the memory used by the tree's nodes and their
+	// item and child slices. It does not include memory referenced by the
+	// items themselves.
+	MemoryBytes int
+}
+
+// LevelStats describes a single level of a BTree.
+//
+// Fill is the fraction of a node's item capacity (order - 1) which is in
+// use.
+type LevelStats struct {
+	Nodes   int
+	Items   int
+	MinFill float64
+	MaxFill float64
+	AvgFill float64
+}
+
+//=============================================================================
+//= Methods
+//=============================================================================
+
+// Stats walks the BTree and returns statistics describing it.
+func (b *BTree) Stats() Stats {
+	var s Stats
+	s.MemoryBytes = int(unsafe.Sizeof(*b))
+	capacity := float64(b.order - 1)
+	nodeSize := int(unsafe.Sizeof(node{}))
+	itemSize := int(unsafe.Sizeof(Item(nil)))
+	childSize := int(unsafe.Sizeof((*node)(nil)))
+
+	for level := (children{b.root}); len(level) > 0; {
+		ls := LevelStats{Nodes: len(level), MinFill: 1}
+		var next children
+		for _, n := range level {
+			fill := float64(len(n.items)) / capacity
+			if fill < ls.MinFill {
+				ls.MinFill = fill
+			}
+			if fill > ls.MaxFill {
+				ls.MaxFill = fill
+			}
+			ls.Items += len(n.items)
+			if len(n.children) == 0 {
+				s.Leaves++
+			}
+			s.MemoryBytes += nodeSize + cap(n.items)*itemSize + cap(n.children)*childSize
+			next = append(next, n.children...)
+		}
+		ls.AvgFill = float64(ls.Items) / (float64(ls.Nodes) * capacity)
+
+		s.Levels = append(s.Levels, ls)
+		s.Height++
+		s.Nodes += ls.Nodes
+		s.Items += ls.Items
+		level = next
+	}
+	return s
+}
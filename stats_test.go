@@ -0,0 +1,53 @@
+package btree
+
+import "testing"
+
+func TestStats(t *testing.T) {
+	cases := []struct {
+		items      []Item
+		order      int
+		fill       float64
+		wantHeight int
+	}{
+		// Should describe empty trees
+		{items: uniqueInputsN(0), order: 3, wantHeight: 1},
+		// Should describe trees of various shapes
+		{items: uniqueInputsN(1000), order: 3, wantHeight: 7},
+		{items: uniqueInputsN(1000), order: 11, wantHeight: 3},
+		{items: uniqueInputsN(1000), order: 11, fill: 0.5, wantHeight: 4},
+		{items: uniqueInputsN(5), order: 11, wantHeight: 1},
+	}
+
+	for _, c := range cases {
+		b, err := BulkloadChecked(c.order, c.items, BulkloadOptions{FillFactor: c.fill})
+		if err != nil {
+			t.Fatalf("BulkloadChecked should not have failed: %v", err)
+		}
+		s := b.Stats()
+
+		if s.Height != c.wantHeight || len(s.Levels) != c.wantHeight {
+			t.Errorf("Stats should report height %d. Got: %d (%d levels)", c.wantHeight, s.Height, len(s.Levels))
+		}
+		if s.Items != len(c.items) {
+			t.Errorf("Stats should report %d items. Got: %d", len(c.items), s.Items)
+		}
+
+		var nodes, items int
+		for i, ls := range s.Levels {
+			nodes += ls.Nodes
+			items += ls.Items
+			if ls.MinFill > ls.AvgFill || ls.AvgFill > ls.MaxFill || ls.MaxFill > 1 {
+				t.Errorf("Level %d fill should satisfy min <= avg <= max <= 1. Got: %+v", i, ls)
+			}
+		}
+		if nodes != s.Nodes || items != s.Items {
+			t.Errorf("Level totals should match tree totals. Got: %+v", s)
+		}
+		if s.Leaves != s.Levels[len(s.Levels)-1].Nodes {
+			t.Errorf("Stats should report every node on the last level as a leaf. Got: %+v", s)
+		}
+		if s.MemoryBytes <= 0 {
+			t.Errorf("Stats should report a positive memory estimate. Got: %d", s.MemoryBytes)
+		}
+	}
+}
@@ -0,0 +1,245 @@
+package btree
+
+import (
+	"strings"
+)
+
+//=============================================================================
+//= Variables and Constants
+//=============================================================================
+
+// Shortest prefix which a compressed key shares with its neighbour. Sharing
+// a prefix costs a second string header, so shorter prefixes save nothing.
+const minSharedPrefix = 16
+
+//=============================================================================
+//= Types
+//=============================================================================
+
+// StringTreeOptions configures a StringTree.
+type StringTreeOptions struct {
+	// CompressPrefixes stores each key's longest prefix shared with a
+	// neighbouring key as a reference to that key's memory, so that keys
+	// with long common prefixes, such as file paths, are mostly stored once.
+	// It makes Set slower, and iterators allocate to return compressed keys.
+	CompressPrefixes bool
+}
+
+// A StringTree is a B-Tree mapping string keys to values, which supports
+// iterating over the keys with a given prefix.
+//
+// It is a BTree whose items are the tree's entries.
+type StringTree struct {
+	tree     *BTree // Entries, as *stringItems.
+	count    int
+	compress bool
+}
+
+// A stringItem is an entry of a StringTree. Its key is prefix+suffix, where
+// prefix is either empty or shares memory with a neighbouring key.
+type stringItem struct {
+	prefix, suffix string
+	value          interface{}
+}
+
+// A StringIterator is a stateful iterator for StringTrees.
+type StringIterator struct {
+	iter   *Iterator
+	prefix string      // Prefix of the keys to return.
+	next   *stringItem // Next entry to return, or nil if there is none.
+}
+
+//=============================================================================
+//= Methods
+//=============================================================================
+
+// Set maps key to value, replacing any existing value for key.
+func (s *StringTree) Set(key string, value interface{}) {
+	probe := &stringItem{suffix: key}
+	if found, ok := s.tree.Search(probe); ok {
+		found.(*stringItem).value = value
+		return
+	}
+	it := &stringItem{suffix: key, value: value}
+	if s.compress {
+		it.share(s.tree.NewReverseIteratorFrom(probe), s.tree.NewIteratorFrom(probe))
+	}
+	s.tree.Insert(it)
+	s.count++
+}
+
+// Get returns the value for key.
+//
+// If key is found, the method returns its value and true.
+// Otherwise, the function returns nil and false.
+func (s *StringTree) Get(key string) (interface{}, bool) {
+	found, ok := s.tree.Search(&stringItem{suffix: key})
+	if !ok {
+		return nil, false
+	}
+	return found.(*stringItem).value, true
+}
+
+// Delete deletes key from the tree, and reports whether it was present.
+func (s *StringTree) Delete(key string) bool {
+	probe := &stringItem{suffix: key}
+	if _, ok := s.tree.Search(probe); !ok {
+		return false
+	}
+	s.tree.Delete(probe)
+	s.count--
+	return true
+}
+
+// Len returns the number of keys in the tree.
+func (s *StringTree) Len() int {
+	return s.count
+}
+
+// NewIterator returns a new iterator over the keys of the tree, in order.
+func (s *StringTree) NewIterator() *StringIterator {
+	return newStringIterator(s.tree.NewIterator(), "")
+}
+
+// NewReverseIterator returns a new iterator over the keys of the tree, in
+// reverse order.
+func (s *StringTree) NewReverseIterator() *StringIterator {
+	return newStringIterator(s.tree.NewReverseIterator(), "")
+}
+
+// PrefixScan returns a new iterator over the keys of the tree which start with
+// prefix, in order.
+func (s *StringTree) PrefixScan(prefix string) *StringIterator {
+	return newStringIterator(s.tree.NewIteratorFrom(&stringItem{suffix: prefix}), prefix)
+}
+
+// HasNext determines if iterator can iterate.
+func (si *StringIterator) HasNext() bool {
+	return si.next != nil
+}
+
+// Next moves the iterator forward and returns its previous value.
+func (si *StringIterator) Next() (string, interface{}, error) {
+	if !si.HasNext() {
+		return "", nil, ErrIteratorExhausted
+	}
+	next := si.next
+	si.advance()
+	return next.key(), next.value, nil
+}
+
+// advance loads the iterator's next entry.
+func (si *StringIterator) advance() {
+	si.next = nil
+	if !si.iter.HasNext() {
+		return
+	}
+	next, _ := si.iter.Next()
+	if it := next.(*stringItem); it.hasPrefix(si.prefix) {
+		si.next = it
+	}
+}
+
+// Less compares the keys of two stringItems.
+func (it *stringItem) Less(other Item) bool {
+	o := other.(*stringItem)
+	return compareSplit(it.prefix, it.suffix, o.prefix, o.suffix) < 0
+}
+
+// Compare compares the keys of two stringItems.
+func (it *stringItem) Compare(other Item) int {
+	o := other.(*stringItem)
+	return compareSplit(it.prefix, it.suffix, o.prefix, o.suffix)
+}
+
+// key returns the item's key.
+func (it *stringItem) key() string {
+	if it.prefix == "" {
+		return it.suffix
+	}
+	return it.prefix + it.suffix
+}
+
+// hasPrefix determines if the item's key starts with prefix.
+func (it *stringItem) hasPrefix(prefix string) bool {
+	if len(prefix) <= len(it.prefix) {
+		return strings.HasPrefix(it.prefix, prefix)
+	}
+	return strings.HasPrefix(prefix, it.prefix) &&
+		strings.HasPrefix(it.suffix, prefix[len(it.prefix):])
+}
+
+// share compresses the item's key by sharing its longest common prefix with
+// the next items of the iterators, if that prefix is long enough. The
+// remainder of the key is copied, so that the item does not retain the memory
+// of the original key.
+func (it *stringItem) share(iters ...*Iterator) {
+	key := it.suffix
+	var shared string
+	for _, iter := range iters {
+		if !iter.HasNext() {
+			continue
+		}
+		next, _ := iter.Next()
+		nb := next.(*stringItem)
+		// Only one of the neighbour's strings can be shared.
+		src := nb.suffix
+		if nb.prefix != "" {
+			src = nb.prefix
+		}
+		n := 0
+		for n < len(src) && n < len(key) && src[n] == key[n] {
+			n++
+		}
+		if n > len(shared) {
+			shared = src[:n]
+		}
+	}
+	if len(shared) >= minSharedPrefix {
+		it.prefix, it.suffix = shared, strings.Clone(key[len(shared):])
+	}
+}
+
+//=============================================================================
+//= Functions
+//=============================================================================
+
+// NewStringTree returns an empty StringTree of the given order.
+func NewStringTree(order int, opts StringTreeOptions) *StringTree {
+	return &StringTree{tree: New(order), compress: opts.CompressPrefixes}
+}
+
+// newStringIterator returns a StringIterator over the entries of iter which
+// start with prefix, stopping at the first which does not.
+func newStringIterator(iter *Iterator, prefix string) *StringIterator {
+	si := &StringIterator{iter: iter, prefix: prefix}
+	si.advance()
+	return si
+}
+
+// compareSplit compares the strings a1+a2 and b1+b2 without concatenating
+// them, returning -1, 0 or +1 as strings.Compare does.
+func compareSplit(a1, a2, b1, b2 string) int {
+	for {
+		if a1 == "" {
+			if a2 == "" {
+				if b1 == "" && b2 == "" {
+					return 0
+				}
+				return -1
+			}
+			a1, a2 = a2, ""
+		}
+		if b1 == "" {
+			if b2 == "" {
+				return 1
+			}
+			b1, b2 = b2, ""
+		}
+		n := min(len(a1), len(b1))
+		if c := strings.Compare(a1[:n], b1[:n]); c != 0 {
+			return c
+		}
+		a1, b1 = a1[n:], b1[n:]
+	}
+}
@@ -0,0 +1,163 @@
+package btree
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"sort"
+	"strings"
+	"testing"
+	"unsafe"
+)
+
+func TestStringTree(t *testing.T) {
+	keys := []string{"", "a", "ab", "abc", "b", "ba", "/var/log/", "/var/log/app/a.log",
+		"/var/log/app/b.log", "/var/lib/", "/var/logs", "\xff"}
+	for _, compress := range []bool{false, true} {
+		for _, order := range []int{3, 4, 16} {
+			s := NewStringTree(order, StringTreeOptions{CompressPrefixes: compress})
+			model := make(map[string]int)
+			for i := 0; i < 3000; i++ {
+				key := keys[rand.Intn(len(keys))] + fmt.Sprint(rand.Intn(20))
+				if rand.Intn(3) > 0 {
+					s.Set(key, i)
+					model[key] = i
+				} else if _, ok := model[key]; s.Delete(key) != ok {
+					t.Fatalf("Delete(%q) should have returned %v", key, ok)
+				} else {
+					delete(model, key)
+				}
+			}
+			checkStringTree(t, s, model)
+		}
+	}
+}
+
+func TestStringTreePrefixScan(t *testing.T) {
+	for _, compress := range []bool{false, true} {
+		s := NewStringTree(4, StringTreeOptions{CompressPrefixes: compress})
+		keys := []string{"/var/lo", "/var/log", "/var/log/", "/var/log/app/a.log",
+			"/var/log/app/b.log", "/var/log/syslog", "/var/log0", "/var/logs", "/var/m"}
+		for _, i := range rand.Perm(len(keys)) {
+			s.Set(keys[i], i)
+		}
+		cases := []struct {
+			prefix string
+			want   []string
+		}{
+			// Should return every key for an empty prefix
+			{prefix: "", want: keys},
+			// Should return keys which start with the prefix, including
+			// the prefix itself
+			{prefix: "/var/log/", want: keys[2:6]},
+			{prefix: "/var/log", want: keys[1:8]},
+			{prefix: "/var/log/app/", want: keys[3:5]},
+			{prefix: "/var/log/app/a.log", want: keys[3:4]},
+			// Should return nothing when no key has the prefix
+			{prefix: "/var/log/x", want: nil},
+			{prefix: "/var/n", want: nil},
+			{prefix: "0", want: nil},
+		}
+		for _, c := range cases {
+			var got []string
+			for iter := s.PrefixScan(c.prefix); iter.HasNext(); {
+				key, _, err := iter.Next()
+				if err != nil {
+					t.Fatalf("Next should not have failed: %v", err)
+				}
+				got = append(got, key)
+			}
+			if strings.Join(got, ",") != strings.Join(c.want, ",") {
+				t.Errorf("PrefixScan(%q) should have returned %q. Got: %q", c.prefix, c.want, got)
+			}
+		}
+	}
+}
+
+func TestStringTreeCompression(t *testing.T) {
+	s := NewStringTree(8, StringTreeOptions{CompressPrefixes: true})
+	const dir = "/var/log/application/"
+	for i := 0; i < 100; i++ {
+		s.Set(fmt.Sprintf("%s%03d.log", dir, i), i)
+	}
+	// Should store the shared directory once, in the first key
+	var base *byte
+	for iter := s.tree.NewIterator(); iter.HasNext(); {
+		next, _ := iter.Next()
+		it := next.(*stringItem)
+		if base == nil {
+			base = unsafe.StringData(it.suffix)
+		} else if len(it.prefix) < len(dir) || unsafe.StringData(it.prefix) != base {
+			t.Fatalf("Key %q should have shared the first key's directory. Got prefix: %q", it.key(), it.prefix)
+		}
+	}
+
+	// Should not share short prefixes
+	s = NewStringTree(8, StringTreeOptions{CompressPrefixes: true})
+	s.Set("/tmp/a", 1)
+	s.Set("/tmp/b", 2)
+	for iter := s.tree.NewIterator(); iter.HasNext(); {
+		if next, _ := iter.Next(); next.(*stringItem).prefix != "" {
+			t.Errorf("Key %q should not have been compressed", next.(*stringItem).key())
+		}
+	}
+}
+
+func TestCompareSplit(t *testing.T) {
+	strs := []string{"", "a", "ab", "abc", "b", "ba", "bab"}
+	for _, a := range strs {
+		for _, b := range strs {
+			want := strings.Compare(a, b)
+			// Should compare every split of a with every split of b
+			for i := 0; i <= len(a); i++ {
+				for j := 0; j <= len(b); j++ {
+					if got := compareSplit(a[:i], a[i:], b[:j], b[j:]); got != want {
+						t.Errorf("compareSplit(%q, %q, %q, %q) should return %d. Got: %d",
+							a[:i], a[i:], b[:j], b[j:], want, got)
+					}
+				}
+			}
+		}
+	}
+}
+
+//=============================================================================
+//= Helpers
+//=============================================================================
+
+// checkStringTree checks that a StringTree holds exactly the entries in want.
+func checkStringTree(t *testing.T, s *StringTree, want map[string]int) {
+	t.Helper()
+	if !isValidBTree(s.tree) {
+		t.Fatalf("StringTree should be a valid BTree")
+	}
+	if s.Len() != len(want) {
+		t.Fatalf("StringTree should contain %d keys. Got: %d", len(want), s.Len())
+	}
+	keys := make([]string, 0, len(want))
+	for key, value := range want {
+		if v, ok := s.Get(key); !ok || v.(int) != value {
+			t.Fatalf("Get(%q) should have returned %d. Got: %v, %v", key, value, v, ok)
+		}
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	iter := s.NewIterator()
+	for _, key := range keys {
+		if k, v, err := iter.Next(); err != nil || k != key || v.(int) != want[key] {
+			t.Fatalf("Iterator should have returned key %q. Got: %q, %v, error: %v", key, k, v, err)
+		}
+	}
+	if _, _, err := iter.Next(); !errors.Is(err, ErrIteratorExhausted) {
+		t.Fatalf("Next should have returned ErrIteratorExhausted. Got: %v", err)
+	}
+	iter = s.NewReverseIterator()
+	for i := len(keys) - 1; i >= 0; i-- {
+		if k, _, err := iter.Next(); err != nil || k != keys[i] {
+			t.Fatalf("Reverse iterator should have returned key %q. Got: %q, error: %v", keys[i], k, err)
+		}
+	}
+	if iter.HasNext() {
+		t.Fatalf("Reverse iterator should no longer have next")
+	}
+}
@@ -0,0 +1,236 @@
+package btree
+
+import (
+	"errors"
+)
+
+//=============================================================================
+//= Variables and Constants
+//=============================================================================
+
+// Kinds of change buffered by a Txn.
+const (
+	txnInsert  = iota // Insert of an item missing from the tree.
+	txnDelete         // Delete of an item in the tree.
+	txnReplace        // Delete of an item in the tree, then insert of a new one.
+)
+
+//=============================================================================
+//= Types
+//=============================================================================
+
+// A Txn is a group of Inserts and Deletes which are applied to a BTree
+// together on Commit, or discarded on Rollback.
+//
+// Changes are buffered in the Txn rather than applied to the tree, and are
+// visible to the Txn's own Search and iterators. The tree must not be
+// modified by other means while a Txn on it is open. Inserts and Deletes on
+// a Txn which has ended have no effect.
+type Txn struct {
+	tree *BTree
+	ops  *BTree // Buffered changes, as txnOps.
+	done bool
+}
+
+// A txnOp is a change buffered by a Txn, ordered by the item it changes.
+type txnOp struct {
+	kind int
+	item Item
+}
+
+// A TxnIterator is a stateful iterator over a Txn's view of its tree.
+type TxnIterator struct {
+	dir  int
+	base *Iterator
+	ops  *Iterator
+
+	nextBase Item   // Next item from base, or nil if not yet read.
+	nextOp   *txnOp // Next change from ops, or nil if not yet read.
+	next     Item   // Next item to return, or nil if exhausted.
+}
+
+//=============================================================================
+//= Methods
+//=============================================================================
+
+// Begin starts a new transaction on the tree.
+func (b *BTree) Begin() *Txn {
+	return &Txn{tree: b, ops: New(b.order)}
+}
+
+// Insert buffers the insertion of an item.
+//
+// As with BTree.Insert, inserting an item which is already visible to the
+// Txn has no effect.
+func (t *Txn) Insert(item Item) {
+	if t.done {
+		return
+	}
+	if op := t.op(item); op != nil {
+		if op.kind == txnDelete {
+			op.kind, op.item = txnReplace, item
+		}
+		return
+	}
+	if _, i := t.tree.search(item); i == -1 {
+		t.ops.Insert(&txnOp{kind: txnInsert, item: item})
+	}
+}
+
+// Delete buffers the deletion of an item.
+//
+// As with BTree.Delete, deleting an item which is not visible to the Txn has
+// no effect.
+func (t *Txn) Delete(item Item) {
+	if t.done {
+		return
+	}
+	if op := t.op(item); op != nil {
+		switch op.kind {
+		case txnInsert:
+			t.ops.Delete(op)
+		case txnReplace:
+			op.kind = txnDelete
+		}
+		return
+	}
+	if container, i := t.tree.search(item); i != -1 {
+		t.ops.Insert(&txnOp{kind: txnDelete, item: container.items[i]})
+	}
+}
+
+// Search searches for an item in the Txn's view of the tree.
+//
+// If the item is found, the method returns it and true.
+// Otherwise, the function returns nil and false.
+func (t *Txn) Search(item Item) (Item, bool) {
+	if op := t.op(item); op != nil {
+		if op.kind == txnDelete {
+			return nil, false
+		}
+		return op.item, true
+	}
+	return t.tree.Search(item)
+}
+
+// NewIterator returns a new iterator over the Txn's view of the tree.
+func (t *Txn) NewIterator() *TxnIterator {
+	return newTxnIterator(forward, t.tree.NewIterator(), t.ops.NewIterator())
+}
+
+// NewReverseIterator returns a new reverse iterator over the Txn's view of
+// the tree.
+func (t *Txn) NewReverseIterator() *TxnIterator {
+	return newTxnIterator(reverse, t.tree.NewReverseIterator(), t.ops.NewReverseIterator())
+}
+
+// Commit applies the Txn's changes to the tree, and ends the Txn.
+func (t *Txn) Commit() error {
+	if t.done {
+		return errors.New("transaction has already been committed or rolled back")
+	}
+	t.done = true
+	for iter := t.ops.NewIterator(); iter.HasNext(); {
+		next, _ := iter.Next()
+		op := next.(*txnOp)
+		if op.kind != txnInsert {
+			t.tree.Delete(op.item)
+		}
+		if op.kind != txnDelete {
+			t.tree.Insert(op.item)
+		}
+	}
+	t.ops = New(t.tree.order)
+	return nil
+}
+
+// Rollback discards the Txn's changes, and ends the Txn.
+func (t *Txn) Rollback() error {
+	if t.done {
+		return errors.New("transaction has already been committed or rolled back")
+	}
+	t.done = true
+	t.ops = New(t.tree.order)
+	return nil
+}
+
+// op returns the buffered change to an item, or nil if there is none.
+func (t *Txn) op(item Item) *txnOp {
+	container, i := t.ops.search(&txnOp{item: item})
+	if i == -1 {
+		return nil
+	}
+	return container.items[i].(*txnOp)
+}
+
+// Less compares the items changed by two txnOps.
+func (op *txnOp) Less(other Item) bool {
+	return op.item.Less(other.(*txnOp).item)
+}
+
+// HasNext determines if iterator can iterate.
+func (ti *TxnIterator) HasNext() bool {
+	return ti.next != nil
+}
+
+// Next moves the iterator forward and returns its previous value.
+func (ti *TxnIterator) Next() (Item, error) {
+	if !ti.HasNext() {
+		return nil, ErrIteratorExhausted
+	}
+	next := ti.next
+	ti.advance()
+	return next, nil
+}
+
+// advance finds the next item to return, merging the tree's items with the
+// Txn's changes.
+func (ti *TxnIterator) advance() {
+	for {
+		if ti.nextBase == nil && ti.base.HasNext() {
+			ti.nextBase, _ = ti.base.Next()
+		}
+		if ti.nextOp == nil && ti.ops.HasNext() {
+			next, _ := ti.ops.Next()
+			ti.nextOp = next.(*txnOp)
+		}
+
+		base, op := ti.nextBase, ti.nextOp
+		switch {
+		case base == nil && op == nil:
+			ti.next = nil
+			return
+		case op == nil || (base != nil && ti.before(base, op.item)):
+			ti.next, ti.nextBase = base, nil
+			return
+		case base != nil && !ti.before(op.item, base):
+			// The change applies to the tree's item, replacing it.
+			ti.nextBase = nil
+		}
+		ti.nextOp = nil
+		if op.kind != txnDelete {
+			ti.next = op.item
+			return
+		}
+	}
+}
+
+// before determines if a comes before b in the iterator's direction.
+func (ti *TxnIterator) before(a, b Item) bool {
+	if ti.dir == reverse {
+		return b.Less(a)
+	}
+	return a.Less(b)
+}
+
+//=============================================================================
+//= Functions
+//=============================================================================
+
+// newTxnIterator returns a TxnIterator merging iterators over a tree and a
+// Txn's changes to it, which move in direction dir.
+func newTxnIterator(dir int, base, ops *Iterator) *TxnIterator {
+	ti := &TxnIterator{dir: dir, base: base, ops: ops}
+	ti.advance()
+	return ti
+}
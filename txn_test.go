@@ -0,0 +1,173 @@
+package btree
+
+import (
+	"math/rand"
+	"sort"
+	"testing"
+)
+
+func TestTxn(t *testing.T) {
+	cases := []struct {
+		order  int
+		keys   int
+		ops    int
+		commit bool
+	}{
+		// Should apply changes on commit
+		{order: 3, keys: 50, ops: 200, commit: true},
+		{order: 8, keys: 500, ops: 2000, commit: true},
+		// Should discard changes on rollback
+		{order: 3, keys: 50, ops: 200, commit: false},
+		{order: 8, keys: 500, ops: 2000, commit: false},
+	}
+
+	for _, c := range cases {
+		tree := New(c.order)
+		before := make(map[int]int)
+		for i := 0; i < c.keys; i += 2 {
+			tree.Insert(&testItem{key: i, val: i})
+			before[i] = i
+		}
+
+		// The Txn should behave like the model, which mirrors the
+		// semantics of BTree.Insert and BTree.Delete.
+		txn := tree.Begin()
+		model := make(map[int]int, len(before))
+		for k, v := range before {
+			model[k] = v
+		}
+		for i := 0; i < c.ops; i++ {
+			key, val := rand.Intn(c.keys), rand.Int()
+			if rand.Intn(2) == 0 {
+				txn.Insert(&testItem{key: key, val: val})
+				if _, ok := model[key]; !ok {
+					model[key] = val
+				}
+			} else {
+				txn.Delete(&testItem{key: key})
+				delete(model, key)
+			}
+		}
+		checkTxn(t, txn, model)
+		// Buffered changes should not be visible in the tree
+		checkTxnTree(t, tree, before)
+
+		var err error
+		want := before
+		if c.commit {
+			err = txn.Commit()
+			want = model
+		} else {
+			err = txn.Rollback()
+		}
+		if err != nil {
+			t.Fatalf("Ending the Txn should not have failed: %v", err)
+		}
+		checkTxnTree(t, tree, want)
+
+		// Should not end a Txn twice, or buffer changes once ended
+		if txn.Commit() == nil || txn.Rollback() == nil {
+			t.Errorf("Ending the Txn a second time should have failed")
+		}
+		txn.Insert(&testItem{key: c.keys})
+		if _, ok := txn.Search(&testItem{key: c.keys}); ok {
+			t.Errorf("Insert on an ended Txn should have had no effect")
+		}
+	}
+}
+
+func TestTxnReplace(t *testing.T) {
+	tree := New(3)
+	tree.Insert(&testItem{key: 1, val: 1})
+	txn := tree.Begin()
+
+	// Should ignore inserts of visible items
+	txn.Insert(&testItem{key: 1, val: 2})
+	if found, _ := txn.Search(&testItem{key: 1}); found.(*testItem).val != 1 {
+		t.Errorf("Insert of a duplicate should have been ignored. Got: %v", found)
+	}
+	// Should replace items which were deleted in the Txn
+	txn.Delete(&testItem{key: 1})
+	if found, ok := txn.Search(&testItem{key: 1}); ok {
+		t.Errorf("Search should not have found deleted item. Got: %v", found)
+	}
+	txn.Insert(&testItem{key: 1, val: 3})
+	if found, _ := txn.Search(&testItem{key: 1}); found.(*testItem).val != 3 {
+		t.Errorf("Search should have found the replacement item. Got: %v", found)
+	}
+	txn.Commit()
+	if found, _ := tree.Search(&testItem{key: 1}); found.(*testItem).val != 3 {
+		t.Errorf("Commit should have replaced the item. Got: %v", found)
+	}
+}
+
+//=============================================================================
+//= Helpers
+//=============================================================================
+
+// checkTxn checks that a Txn's view of its tree holds exactly the items in
+// want, which maps keys to values.
+func checkTxn(t *testing.T, txn *Txn, want map[int]int) {
+	t.Helper()
+	keys := sortedKeys(want)
+	maxKey := 0
+	if len(keys) > 0 {
+		maxKey = keys[len(keys)-1]
+	}
+	for k := -1; k <= maxKey+1; k++ {
+		found, present := txn.Search(&testItem{key: k})
+		if v, ok := want[k]; ok != present || (ok && found.(*testItem).val != v) {
+			t.Fatalf("Txn Search(%d) should have returned %v. Got: %v", k, ok, found)
+		}
+	}
+
+	iter := txn.NewIterator()
+	for _, k := range keys {
+		next, err := iter.Next()
+		if err != nil || next.(*testItem).key != k || next.(*testItem).val != want[k] {
+			t.Fatalf("Txn iterator should have returned key %d. Got: %v, error: %v", k, next, err)
+		}
+	}
+	if iter.HasNext() {
+		t.Fatalf("Txn iterator should no longer have next")
+	}
+	iter = txn.NewReverseIterator()
+	for i := len(keys) - 1; i >= 0; i-- {
+		next, err := iter.Next()
+		if err != nil || next.(*testItem).key != keys[i] {
+			t.Fatalf("Txn reverse iterator should have returned key %d. Got: %v, error: %v", keys[i], next, err)
+		}
+	}
+	if _, err := iter.Next(); err == nil {
+		t.Fatalf("Next should have failed on an exhausted iterator")
+	}
+}
+
+// checkTxnTree checks that a BTree is valid and holds exactly the items in
+// want, which maps keys to values.
+func checkTxnTree(t *testing.T, tree *BTree, want map[int]int) {
+	t.Helper()
+	if err := tree.Validate(); err != nil {
+		t.Fatalf("Tree should be valid: %v", err)
+	}
+	iter := tree.NewIterator()
+	for _, k := range sortedKeys(want) {
+		next, err := iter.Next()
+		if err != nil || next.(*testItem).key != k || next.(*testItem).val != want[k] {
+			t.Fatalf("Tree should contain key %d. Got: %v, error: %v", k, next, err)
+		}
+	}
+	if iter.HasNext() {
+		t.Fatalf("Tree should not contain more items")
+	}
+}
+
+// sortedKeys returns the keys of m in ascending order.
+func sortedKeys(m map[int]int) []int {
+	keys := make([]int, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Ints(keys)
+	return keys
+}
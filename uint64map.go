@@ -0,0 +1,458 @@
+package btree
+
+import (
+	"math/bits"
+)
+
+//=============================================================================
+//= Variables and Constants
+//=============================================================================
+
+// Bit which is flipped to map int64 keys onto uint64 keys in the same order.
+const int64SignBit = 1 << 63
+
+//=============================================================================
+//= Types
+//=============================================================================
+
+// A Uint64Map is a B-Tree mapping uint64 keys to values.
+//
+// It is specialized for integer keys: each node stores its keys in a
+// contiguous array, which is searched with a branchless linear scan instead
+// of a binary search through the Item interface.
+type Uint64Map struct {
+	order int
+	root  *u64Node
+	count int
+}
+
+// An Int64Tree is a B-Tree mapping int64 keys to values.
+//
+// It is a Uint64Map whose keys have their sign bit flipped, which maps the
+// int64 keys onto uint64 keys in the same order.
+type Int64Tree struct {
+	m Uint64Map
+}
+
+// A u64Node is a node of a Uint64Map. The value of keys[i] is values[i].
+type u64Node struct {
+	keys     []uint64
+	values   []interface{}
+	children []*u64Node
+}
+
+// A Uint64Iterator is a stateful iterator for Uint64Maps.
+type Uint64Iterator struct {
+	dir   int
+	stack []u64Frame // Path from the root to the next entry.
+}
+
+// An Int64Iterator is a stateful iterator for Int64Trees.
+type Int64Iterator struct {
+	it *Uint64Iterator
+}
+
+// A u64Frame is a node on a Uint64Iterator's path, with the index of the
+// next entry to return from it.
+type u64Frame struct {
+	n *u64Node
+	i int
+}
+
+//=============================================================================
+//= Methods
+//=============================================================================
+
+// Set maps key to value, replacing any existing value for key.
+func (m *Uint64Map) Set(key uint64, value interface{}) {
+	k, v, right, inserted := m.insert(m.root, key, value)
+	if right != nil {
+		root := m.newNode(false)
+		root.keys = append(root.keys, k)
+		root.values = append(root.values, v)
+		root.children = append(root.children, m.root, right)
+		m.root = root
+	}
+	if inserted {
+		m.count++
+	}
+}
+
+// Get returns the value for key.
+// If the key is not in the map, the method returns nil and false.
+func (m *Uint64Map) Get(key uint64) (interface{}, bool) {
+	n := m.root
+	for {
+		i := n.find(key)
+		if i < len(n.keys) && n.keys[i] == key {
+			return n.values[i], true
+		} else if len(n.children) == 0 {
+			return nil, false
+		}
+		n = n.children[i]
+	}
+}
+
+// Delete removes key from the map, and reports whether it was present.
+func (m *Uint64Map) Delete(key uint64) bool {
+	if !m.delete(m.root, key) {
+		return false
+	}
+	if len(m.root.keys) == 0 && len(m.root.children) > 0 {
+		m.root = m.root.children[0]
+	}
+	m.count--
+	return true
+}
+
+// Len returns the number of keys in the map.
+func (m *Uint64Map) Len() int {
+	return m.count
+}
+
+// NewIterator returns a new iterator for the map, in ascending key order.
+func (m *Uint64Map) NewIterator() *Uint64Iterator {
+	return newUint64Iterator(m.root, forward)
+}
+
+// NewReverseIterator returns a new iterator for the map, in descending key
+// order.
+func (m *Uint64Map) NewReverseIterator() *Uint64Iterator {
+	return newUint64Iterator(m.root, reverse)
+}
+
+// insert maps key to value in the subtree rooted at n, and reports whether
+// key was newly inserted.
+//
+// If n overflows, it is split: n keeps the left half, and the median entry
+// and right half are returned for the caller to add to the parent.
+func (m *Uint64Map) insert(n *u64Node, key uint64, value interface{}) (uint64, interface{}, *u64Node, bool) {
+	i := n.find(key)
+	if i < len(n.keys) && n.keys[i] == key {
+		n.values[i] = value
+		return 0, nil, nil, false
+	}
+	if len(n.children) == 0 {
+		n.insertAt(i, key, value)
+	} else {
+		k, v, right, inserted := m.insert(n.children[i], key, value)
+		if right != nil {
+			n.insertAt(i, k, v)
+			n.children = append(n.children, nil)
+			copy(n.children[i+2:], n.children[i+1:])
+			n.children[i+1] = right
+		}
+		if !inserted {
+			return 0, nil, nil, false
+		}
+	}
+	if len(n.keys) < m.order {
+		return 0, nil, nil, true
+	}
+
+	mid := len(n.keys) / 2
+	k, v := n.keys[mid], n.values[mid]
+	right := m.newNode(len(n.children) == 0)
+	right.keys = append(right.keys, n.keys[mid+1:]...)
+	right.values = append(right.values, n.values[mid+1:]...)
+	n.keys = n.keys[:mid]
+	clear(n.values[mid:])
+	n.values = n.values[:mid]
+	if len(n.children) > 0 {
+		right.children = append(right.children, n.children[mid+1:]...)
+		clear(n.children[mid+1:])
+		n.children = n.children[:mid+1]
+	}
+	return k, v, right, true
+}
+
+// delete removes key from the subtree rooted at n, and reports whether it
+// was present.
+//
+// n may be left with too few keys, in which case the caller must rebalance
+// it.
+func (m *Uint64Map) delete(n *u64Node, key uint64) bool {
+	i := n.find(key)
+	found := i < len(n.keys) && n.keys[i] == key
+	if len(n.children) == 0 {
+		if found {
+			n.deleteAt(i)
+		}
+		return found
+	}
+
+	// A key in an internal node is replaced with the maximum entry of its
+	// left subtree, which is deleted from the subtree instead.
+	if found {
+		n.keys[i], n.values[i] = m.deleteMax(n.children[i])
+	} else if !m.delete(n.children[i], key) {
+		return false
+	}
+	m.rebalance(n, i)
+	return true
+}
+
+// deleteMax removes the maximum entry of the subtree rooted at n, and
+// returns it.
+func (m *Uint64Map) deleteMax(n *u64Node) (uint64, interface{}) {
+	if len(n.children) == 0 {
+		last := len(n.keys) - 1
+		k, v := n.keys[last], n.values[last]
+		n.deleteAt(last)
+		return k, v
+	}
+	last := len(n.children) - 1
+	k, v := m.deleteMax(n.children[last])
+	m.rebalance(n, last)
+	return k, v
+}
+
+// rebalance ensures that the i-th child of n holds at least the minimum
+// number of keys, by borrowing a key from a sibling or merging it with one.
+func (m *Uint64Map) rebalance(n *u64Node, i int) {
+	minKeys := (m.order+1)/2 - 1
+	child := n.children[i]
+	if len(child.keys) >= minKeys {
+		return
+	}
+	leaf := len(child.children) == 0
+
+	// 1. Borrow from the left sibling, through the separator.
+	if i > 0 && len(n.children[i-1].keys) > minKeys {
+		left := n.children[i-1]
+		last := len(left.keys) - 1
+		child.insertAt(0, n.keys[i-1], n.values[i-1])
+		n.keys[i-1], n.values[i-1] = left.keys[last], left.values[last]
+		left.deleteAt(last)
+		if !leaf {
+			c := left.children[len(left.children)-1]
+			left.children[len(left.children)-1] = nil
+			left.children = left.children[:len(left.children)-1]
+			child.children = append(child.children, nil)
+			copy(child.children[1:], child.children)
+			child.children[0] = c
+		}
+		return
+	}
+
+	// 2. Borrow from the right sibling, through the separator.
+	if i < len(n.children)-1 && len(n.children[i+1].keys) > minKeys {
+		right := n.children[i+1]
+		child.keys = append(child.keys, n.keys[i])
+		child.values = append(child.values, n.values[i])
+		n.keys[i], n.values[i] = right.keys[0], right.values[0]
+		right.deleteAt(0)
+		if !leaf {
+			child.children = append(child.children, right.children[0])
+			copy(right.children, right.children[1:])
+			right.children[len(right.children)-1] = nil
+			right.children = right.children[:len(right.children)-1]
+		}
+		return
+	}
+
+	// 3. Merge with a sibling and the separator between them.
+	if i > 0 {
+		i--
+	}
+	left, right := n.children[i], n.children[i+1]
+	left.keys = append(append(left.keys, n.keys[i]), right.keys...)
+	left.values = append(append(left.values, n.values[i]), right.values...)
+	left.children = append(left.children, right.children...)
+	n.deleteAt(i)
+	copy(n.children[i+1:], n.children[i+2:])
+	n.children[len(n.children)-1] = nil
+	n.children = n.children[:len(n.children)-1]
+}
+
+// newNode returns an empty node, with its arrays allocated at full capacity.
+func (m *Uint64Map) newNode(leaf bool) *u64Node {
+	n := &u64Node{
+		keys:   make([]uint64, 0, m.order),
+		values: make([]interface{}, 0, m.order),
+	}
+	if !leaf {
+		n.children = make([]*u64Node, 0, m.order+1)
+	}
+	return n
+}
+
+// find returns the index of the first key in the node which is not less than
+// key, or the number of keys if there is none.
+//
+// Because the keys are sorted, this is the number of keys less than key. The
+// keys are counted in blocks of four without branching, using the borrow of
+// a subtraction as the result of each comparison, and the scan stops at the
+// first block which holds a key not less than key.
+func (n *u64Node) find(key uint64) int {
+	keys := n.keys
+	i := 0
+	for ; i+4 <= len(keys); i += 4 {
+		_, b0 := bits.Sub64(keys[i], key, 0)
+		_, b1 := bits.Sub64(keys[i+1], key, 0)
+		_, b2 := bits.Sub64(keys[i+2], key, 0)
+		_, b3 := bits.Sub64(keys[i+3], key, 0)
+		if c := int(b0 + b1 + b2 + b3); c < 4 {
+			return i + c
+		}
+	}
+	for ; i < len(keys); i++ {
+		if keys[i] >= key {
+			break
+		}
+	}
+	return i
+}
+
+// insertAt inserts an entry into the node at the given index.
+func (n *u64Node) insertAt(i int, key uint64, value interface{}) {
+	n.keys = append(n.keys, 0)
+	copy(n.keys[i+1:], n.keys[i:])
+	n.keys[i] = key
+	n.values = append(n.values, nil)
+	copy(n.values[i+1:], n.values[i:])
+	n.values[i] = value
+}
+
+// deleteAt deletes the entry at the given index from the node.
+func (n *u64Node) deleteAt(i int) {
+	copy(n.keys[i:], n.keys[i+1:])
+	n.keys = n.keys[:len(n.keys)-1]
+	copy(n.values[i:], n.values[i+1:])
+	n.values[len(n.values)-1] = nil
+	n.values = n.values[:len(n.values)-1]
+}
+
+// HasNext determines if iterator can iterate.
+func (ui *Uint64Iterator) HasNext() bool {
+	return len(ui.stack) > 0
+}
+
+// Next moves the iterator forward and returns the entry it was positioned
+// at.
+func (ui *Uint64Iterator) Next() (uint64, interface{}, error) {
+	if !ui.HasNext() {
+		return 0, nil, ErrIteratorExhausted
+	}
+	top := &ui.stack[len(ui.stack)-1]
+	n, i := top.n, top.i
+	top.i += ui.dir
+	if len(n.children) > 0 {
+		// The next entry is at the edge of the subtree beside this one.
+		child := i + 1
+		if ui.dir == reverse {
+			child = i
+		}
+		ui.descend(n.children[child])
+	}
+	ui.trim()
+	return n.keys[i], n.values[i], nil
+}
+
+// descend pushes the path from n to the first entry of its subtree in the
+// iterator's direction.
+func (ui *Uint64Iterator) descend(n *u64Node) {
+	for {
+		i, child := 0, 0
+		if ui.dir == reverse {
+			i, child = len(n.keys)-1, len(n.children)-1
+		}
+		ui.stack = append(ui.stack, u64Frame{n: n, i: i})
+		if len(n.children) == 0 {
+			return
+		}
+		n = n.children[child]
+	}
+}
+
+// trim pops the nodes with no entries left to return.
+func (ui *Uint64Iterator) trim() {
+	for len(ui.stack) > 0 {
+		top := ui.stack[len(ui.stack)-1]
+		if 0 <= top.i && top.i < len(top.n.keys) {
+			return
+		}
+		ui.stack = ui.stack[:len(ui.stack)-1]
+	}
+}
+
+// Set maps key to value, replacing any existing value for key.
+func (t *Int64Tree) Set(key int64, value interface{}) {
+	t.m.Set(uint64(key)^int64SignBit, value)
+}
+
+// Get returns the value for key.
+// If the key is not in the tree, the method returns nil and false.
+func (t *Int64Tree) Get(key int64) (interface{}, bool) {
+	return t.m.Get(uint64(key) ^ int64SignBit)
+}
+
+// Delete removes key from the tree, and reports whether it was present.
+func (t *Int64Tree) Delete(key int64) bool {
+	return t.m.Delete(uint64(key) ^ int64SignBit)
+}
+
+// Len returns the number of keys in the tree.
+func (t *Int64Tree) Len() int {
+	return t.m.Len()
+}
+
+// NewIterator returns a new iterator for the tree, in ascending key order.
+func (t *Int64Tree) NewIterator() *Int64Iterator {
+	return &Int64Iterator{it: t.m.NewIterator()}
+}
+
+// NewReverseIterator returns a new iterator for the tree, in descending key
+// order.
+func (t *Int64Tree) NewReverseIterator() *Int64Iterator {
+	return &Int64Iterator{it: t.m.NewReverseIterator()}
+}
+
+// HasNext determines if iterator can iterate.
+func (ii *Int64Iterator) HasNext() bool {
+	return ii.it.HasNext()
+}
+
+// Next moves the iterator forward and returns the entry it was positioned
+// at.
+func (ii *Int64Iterator) Next() (int64, interface{}, error) {
+	key, value, err := ii.it.Next()
+	if err != nil {
+		return 0, nil, err
+	}
+	return int64(key ^ int64SignBit), value, nil
+}
+
+//=============================================================================
+//= Functions
+//=============================================================================
+
+// NewUint64Map returns an empty Uint64Map of the given order.
+// It returns ErrInvalidOrder if the order is less than 3.
+func NewUint64Map(order int) (*Uint64Map, error) {
+	if order < 3 {
+		return nil, ErrInvalidOrder
+	}
+	m := &Uint64Map{order: order}
+	m.root = m.newNode(true)
+	return m, nil
+}
+
+// NewInt64Tree returns an empty Int64Tree of the given order.
+// It returns ErrInvalidOrder if the order is less than 3.
+func NewInt64Tree(order int) (*Int64Tree, error) {
+	m, err := NewUint64Map(order)
+	if err != nil {
+		return nil, err
+	}
+	return &Int64Tree{m: *m}, nil
+}
+
+// newUint64Iterator returns an iterator over the subtree rooted at root,
+// which moves in direction dir.
+func newUint64Iterator(root *u64Node, dir int) *Uint64Iterator {
+	ui := &Uint64Iterator{dir: dir}
+	ui.descend(root)
+	ui.trim()
+	return ui
+}
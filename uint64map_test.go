@@ -0,0 +1,249 @@
+package btree
+
+import (
+	"errors"
+	"math"
+	"math/rand"
+	"sort"
+	"testing"
+)
+
+func TestUint64Map(t *testing.T) {
+	for _, order := range []int{3, 4, 5, 8, 32} {
+		m, err := NewUint64Map(order)
+		if err != nil {
+			t.Fatalf("NewUint64Map should not have failed: %v", err)
+		}
+		model := make(map[uint64]int)
+		for i := 0; i < 5000; i++ {
+			key := uint64(rand.Intn(1000))
+			if rand.Intn(3) > 0 {
+				m.Set(key, i)
+				model[key] = i
+			} else if deleted := m.Delete(key); deleted != hasKey(model, key) {
+				t.Fatalf("Delete(%d) should have returned %v", key, !deleted)
+			} else {
+				delete(model, key)
+			}
+		}
+		checkUint64Map(t, m, model)
+
+		// Should delete every key
+		for key := range model {
+			m.Delete(key)
+		}
+		checkUint64Map(t, m, nil)
+	}
+
+	// Should reject invalid orders
+	if _, err := NewUint64Map(2); !errors.Is(err, ErrInvalidOrder) {
+		t.Errorf("NewUint64Map should have returned ErrInvalidOrder. Got: %v", err)
+	}
+}
+
+func TestUint64Find(t *testing.T) {
+	// Should return the lower bound for every key and node size, across the
+	// unrolled blocks and the remainder.
+	for size := 0; size <= 12; size++ {
+		n := &u64Node{}
+		for i := 0; i < size; i++ {
+			n.keys = append(n.keys, uint64(2*i+1))
+		}
+		n.keys = append(n.keys, math.MaxUint64)[:size]
+		for key := uint64(0); key <= uint64(2*size+1); key++ {
+			want := sort.Search(size, func(i int) bool { return n.keys[i] >= key })
+			if got := n.find(key); got != want {
+				t.Errorf("find(%d) in %d keys should return %d. Got: %d", key, size, want, got)
+			}
+		}
+	}
+	// Should compare keys as unsigned
+	n := &u64Node{keys: []uint64{0, 1, 1 << 63, math.MaxUint64 - 1, math.MaxUint64}}
+	if got := n.find(1 << 62); got != 2 {
+		t.Errorf("find(1<<62) should return 2. Got: %d", got)
+	}
+	if got := n.find(math.MaxUint64); got != 4 {
+		t.Errorf("find(MaxUint64) should return 4. Got: %d", got)
+	}
+}
+
+func TestInt64Tree(t *testing.T) {
+	tree, _ := NewInt64Tree(4)
+	keys := []int64{math.MinInt64, -1000, -1, 0, 1, 1000, math.MaxInt64}
+	for _, i := range rand.Perm(len(keys)) {
+		tree.Set(keys[i], keys[i])
+	}
+
+	// Should order negative keys before positive ones
+	iter := tree.NewIterator()
+	for _, want := range keys {
+		key, value, err := iter.Next()
+		if err != nil || key != want || value.(int64) != want {
+			t.Fatalf("Iterator should have returned %d. Got: %d, %v, error: %v", want, key, value, err)
+		}
+	}
+	iter = tree.NewReverseIterator()
+	for i := len(keys) - 1; i >= 0; i-- {
+		if key, _, err := iter.Next(); err != nil || key != keys[i] {
+			t.Fatalf("Reverse iterator should have returned %d. Got: %d, error: %v", keys[i], key, err)
+		}
+	}
+	if _, _, err := iter.Next(); !errors.Is(err, ErrIteratorExhausted) {
+		t.Errorf("Next should have returned ErrIteratorExhausted. Got: %v", err)
+	}
+
+	if v, ok := tree.Get(-1000); !ok || v.(int64) != -1000 {
+		t.Errorf("Get(-1000) should have found -1000. Got: %v, %v", v, ok)
+	}
+	if !tree.Delete(math.MinInt64) || tree.Delete(math.MinInt64) || tree.Len() != len(keys)-1 {
+		t.Errorf("Delete should have removed MinInt64 once")
+	}
+}
+
+//=============================================================================
+//= Benchmarks
+//=============================================================================
+
+func benchmarkUint64MapSet(size int, b *testing.B) {
+	keys := rand.Perm(size)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		m, _ := NewUint64Map(32)
+		for _, k := range keys {
+			m.Set(uint64(k), nil)
+		}
+	}
+}
+
+func benchmarkUint64MapGet(size int, b *testing.B) {
+	keys := rand.Perm(size)
+	m, _ := NewUint64Map(32)
+	for _, k := range keys {
+		m.Set(uint64(k), nil)
+	}
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		for _, k := range keys {
+			m.Get(uint64(k))
+		}
+	}
+}
+
+func benchmarkBTreeInsertInts(size int, b *testing.B) {
+	keys := rand.Perm(size)
+	its := make([]Item, size)
+	for i, k := range keys {
+		its[i] = &testItem{key: k}
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		bt := New(32)
+		for _, item := range its {
+			bt.Insert(item)
+		}
+	}
+}
+
+func benchmarkBTreeSearchInts(size int, b *testing.B) {
+	keys := rand.Perm(size)
+	its := make([]Item, size)
+	bt := New(32)
+	for i, k := range keys {
+		its[i] = &testItem{key: k}
+		bt.Insert(its[i])
+	}
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		for _, item := range its {
+			bt.Search(item)
+		}
+	}
+}
+
+func BenchmarkUint64MapSet100000(b *testing.B)    { benchmarkUint64MapSet(100000, b) }
+func BenchmarkBTreeInsertInts100000(b *testing.B) { benchmarkBTreeInsertInts(100000, b) }
+func BenchmarkUint64MapGet100000(b *testing.B)    { benchmarkUint64MapGet(100000, b) }
+func BenchmarkBTreeSearchInts100000(b *testing.B) { benchmarkBTreeSearchInts(100000, b) }
+
+//=============================================================================
+//= Helpers
+//=============================================================================
+
+// hasKey determines if key is in m.
+func hasKey(m map[uint64]int, key uint64) bool {
+	_, ok := m[key]
+	return ok
+}
+
+// checkUint64Map checks that a Uint64Map satisfies the B-Tree invariants and
+// holds exactly the entries in want.
+func checkUint64Map(t *testing.T, m *Uint64Map, want map[uint64]int) {
+	t.Helper()
+	if m.Len() != len(want) {
+		t.Fatalf("Uint64Map should contain %d keys. Got: %d", len(want), m.Len())
+	}
+	minKeys := (m.order+1)/2 - 1
+	leafDepth := -1
+	var walk func(n *u64Node, depth int)
+	walk = func(n *u64Node, depth int) {
+		if n != m.root && len(n.keys) < minKeys {
+			t.Fatalf("Node has too few keys: %d", len(n.keys))
+		}
+		if len(n.keys) > m.order-1 || len(n.values) != len(n.keys) {
+			t.Fatalf("Node has %d keys and %d values", len(n.keys), len(n.values))
+		}
+		if cap(n.keys) != m.order {
+			t.Fatalf("Node keys should have capacity %d. Got: %d", m.order, cap(n.keys))
+		}
+		if len(n.children) == 0 {
+			if leafDepth == -1 {
+				leafDepth = depth
+			} else if depth != leafDepth {
+				t.Fatalf("Leaf is at depth %d, other leaves are at %d", depth, leafDepth)
+			}
+			return
+		}
+		if len(n.children) != len(n.keys)+1 {
+			t.Fatalf("Node has %d children but %d keys", len(n.children), len(n.keys))
+		}
+		for _, c := range n.children {
+			walk(c, depth+1)
+		}
+	}
+	walk(m.root, 0)
+
+	for key, value := range want {
+		if v, ok := m.Get(key); !ok || v.(int) != value {
+			t.Fatalf("Get(%d) should have returned %d. Got: %v, %v", key, value, v, ok)
+		}
+	}
+	if _, ok := m.Get(math.MaxUint64); ok {
+		t.Fatalf("Get should not have found a missing key")
+	}
+
+	keys := make([]uint64, 0, len(want))
+	for key := range want {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i] < keys[j] })
+	iter := m.NewIterator()
+	for _, key := range keys {
+		if k, v, err := iter.Next(); err != nil || k != key || v.(int) != want[key] {
+			t.Fatalf("Iterator should have returned key %d. Got: %d, %v, error: %v", key, k, v, err)
+		}
+	}
+	if iter.HasNext() {
+		t.Fatalf("Iterator should no longer have next")
+	}
+	iter = m.NewReverseIterator()
+	for i := len(keys) - 1; i >= 0; i-- {
+		if k, _, err := iter.Next(); err != nil || k != keys[i] {
+			t.Fatalf("Reverse iterator should have returned key %d. Got: %d, error: %v", keys[i], k, err)
+		}
+	}
+	if iter.HasNext() {
+		t.Fatalf("Reverse iterator should no longer have next")
+	}
+}
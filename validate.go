@@ -0,0 +1,118 @@
+package btree
+
+import (
+	"errors"
+	"fmt"
+	"math"
+)
+
+//=============================================================================
+//= Types
+//=============================================================================
+
+// A validator holds the state needed to validate a BTree.
+type validator struct {
+	order       int
+	minChildren int
+	leafDepth   int // Depth of the first leaf visited, or -1 if none yet.
+}
+
+//=============================================================================
+//= Methods
+//=============================================================================
+
+// Validate checks that the BTree satisfies every B-Tree invariant.
+//
+// For a BTree of order m, every node must have at most m children and hold
+// its items in strictly ascending order, bounded by the separators in its
+// ancestors. Every internal node with k children must hold k-1 items, and
+// every internal node other than the root must have at least ceil(m/2)
+// children. Leaves other than the root must not be empty, and all leaves must
+// be at the same depth. Finally, each node's parent pointer must refer to the
+// node which holds it as a child.
+//
+// If an invariant does not hold, the returned error describes the violation
+// and the path from the root to the offending node.
+func (b *BTree) Validate() error {
+	if b.root == nil {
+		return errors.New("root: BTree has no root node")
+	}
+	if b.root.parent != nil {
+		return errors.New("root: root node has a parent")
+	}
+	v := validator{
+		order:       b.order,
+		minChildren: int(math.Ceil(float64(b.order) / 2.0)),
+		leafDepth:   -1,
+	}
+	return v.validate(b.root, "root", 0, nil, nil)
+}
+
+// validate recursively validates the subtree rooted at n.
+// Every item in the subtree must fall in the open interval (lo, hi), where a
+// nil bound is unbounded.
+func (v *validator) validate(n *node, path string, depth int, lo, hi Item) error {
+	isRoot := n.parent == nil
+	isLeaf := len(n.children) == 0
+
+	if len(n.items) > v.order-1 {
+		return fmt.Errorf("%s: node has %d items, more than the maximum of %d", path, len(n.items), v.order-1)
+	}
+	for i, item := range n.items {
+		if i > 0 && !n.items[i-1].Less(item) {
+			return fmt.Errorf("%s: items[%d] is not greater than items[%d]", path, i, i-1)
+		}
+		if lo != nil && !lo.Less(item) {
+			return fmt.Errorf("%s: items[%d] is not greater than separator %v", path, i, lo)
+		}
+		if hi != nil && !item.Less(hi) {
+			return fmt.Errorf("%s: items[%d] is not less than separator %v", path, i, hi)
+		}
+	}
+
+	if isLeaf {
+		if !isRoot && len(n.items) == 0 {
+			return fmt.Errorf("%s: non-root leaf is empty", path)
+		}
+		if v.leafDepth == -1 {
+			v.leafDepth = depth
+		} else if depth != v.leafDepth {
+			return fmt.Errorf("%s: leaf is at depth %d, but other leaves are at depth %d", path, depth, v.leafDepth)
+		}
+		return nil
+	}
+
+	if len(n.children) != len(n.items)+1 {
+		return fmt.Errorf("%s: node has %d children but %d items", path, len(n.children), len(n.items))
+	}
+	if len(n.children) > v.order {
+		return fmt.Errorf("%s: node has %d children, more than the maximum of %d", path, len(n.children), v.order)
+	}
+	if isRoot && len(n.children) < 2 {
+		return fmt.Errorf("%s: non-leaf root has fewer than 2 children", path)
+	}
+	if !isRoot && len(n.children) < v.minChildren {
+		return fmt.Errorf("%s: node has %d children, fewer than the minimum of %d", path, len(n.children), v.minChildren)
+	}
+
+	for i, c := range n.children {
+		childPath := fmt.Sprintf("%s.children[%d]", path, i)
+		if c == nil {
+			return fmt.Errorf("%s: child is nil", childPath)
+		}
+		if c.parent != n {
+			return fmt.Errorf("%s: parent pointer does not refer to its parent", childPath)
+		}
+		childLo, childHi := lo, hi
+		if i > 0 {
+			childLo = n.items[i-1]
+		}
+		if i < len(n.items) {
+			childHi = n.items[i]
+		}
+		if err := v.validate(c, childPath, depth+1, childLo, childHi); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,70 @@
+package btree
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestValidate(t *testing.T) {
+	cases := []struct {
+		order   int
+		corrupt func(b *BTree)
+		wantErr string
+	}{
+		// Should accept valid trees of various orders
+		{order: 3},
+		{order: 8},
+		{order: 31},
+		// Should reject out of order items
+		{order: 5, corrupt: func(b *BTree) {
+			leaf := b.min(b.root)
+			leaf.items[0], leaf.items[1] = leaf.items[1], leaf.items[0]
+		}, wantErr: ".children[0]: items[1] is not greater than items[0]"},
+		// Should reject items outside of their separators
+		{order: 5, corrupt: func(b *BTree) {
+			leaf := b.max(b.root.children[0])
+			leaf.items[0] = &testItem{key: -1}
+		}, wantErr: "is not greater than separator"},
+		// Should reject overfull nodes
+		{order: 5, corrupt: func(b *BTree) {
+			leaf := b.max(b.root)
+			for len(leaf.items) < 5 {
+				leaf.items = append(leaf.items, &testItem{key: 10000 + len(leaf.items)})
+			}
+		}, wantErr: "more than the maximum of 4"},
+		// Should reject empty leaves
+		{order: 5, corrupt: func(b *BTree) {
+			leaf := b.max(b.root)
+			leaf.items = leaf.items[:0]
+		}, wantErr: "non-root leaf is empty"},
+		// Should reject mismatched child and item counts
+		{order: 5, corrupt: func(b *BTree) {
+			b.root.children = b.root.children[:len(b.root.children)-1]
+		}, wantErr: "root: node has"},
+		// Should reject inconsistent parent pointers
+		{order: 5, corrupt: func(b *BTree) {
+			b.root.children[1].children[0].parent = b.root
+		}, wantErr: "root.children[1].children[0]: parent pointer"},
+		// Should reject root with a parent
+		{order: 5, corrupt: func(b *BTree) {
+			b.root.parent = b.root.children[0]
+		}, wantErr: "root: root node has a parent"},
+	}
+
+	for _, c := range cases {
+		b := Bulkload(c.order, uniqueInputsN(1000))
+		if c.corrupt != nil {
+			c.corrupt(b)
+		}
+		err := b.Validate()
+		if c.wantErr == "" {
+			if err != nil {
+				t.Errorf("Valid tree of order %d should not have failed validation: %v", c.order, err)
+			}
+			continue
+		}
+		if err == nil || !strings.Contains(err.Error(), c.wantErr) {
+			t.Errorf("Validation error should contain %q. Got: %v", c.wantErr, err)
+		}
+	}
+}
@@ -0,0 +1,396 @@
+package btree
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+//=============================================================================
+//= Variables and Constants
+//=============================================================================
+
+// Sync policies for WALOptions.
+const (
+	// SyncAlways commits every record to stable storage before the
+	// operation returns.
+	SyncAlways SyncPolicy = iota
+	// SyncBatch commits records to stable storage after every
+	// WALOptions.SyncEvery records.
+	SyncBatch
+	// SyncNever leaves committing records to the operating system, or to
+	// explicit calls to Sync.
+	SyncNever
+)
+
+// Default number of records between syncs for SyncBatch.
+const defaultSyncEvery = 100
+
+// Operations recorded in a WAL.
+const (
+	walInsert = 1
+	walDelete = 2
+)
+
+// Size of a WAL record header, holding the payload length and checksum.
+const walHeaderSize = 4 + 4
+
+// Names of the files in a durable tree's directory.
+const (
+	snapshotFile = "snapshot"
+	walFile      = "wal"
+	walOldFile   = "wal.old" // Log rotated out by an unfinished checkpoint.
+)
+
+//=============================================================================
+//= Types
+//=============================================================================
+
+// A SyncPolicy controls when a WAL commits records to stable storage.
+type SyncPolicy int
+
+// WALOptions configures a WAL.
+type WALOptions struct {
+	Sync SyncPolicy
+
+	// SyncEvery is the number of records between syncs for SyncBatch,
+	// defaulting to 100.
+	SyncEvery int
+}
+
+// A WAL is a write-ahead log of Insert and Delete operations.
+//
+// Each record holds an operation and its encoded item, prefixed with the
+// record's length and a CRC-32 checksum so that torn or corrupted writes can
+// be detected when the log is replayed.
+type WAL struct {
+	file     *os.File
+	codec    ItemCodec
+	opts     WALOptions
+	size     int64 // Size of the log in bytes.
+	unsynced int   // Number of records written since the last sync.
+}
+
+// A DurableBTree is a BTree whose Inserts and Deletes are recorded in a WAL
+// before they are applied, so that it can be recovered after a crash.
+//
+// Its state is stored in a directory holding an optional snapshot of the
+// tree, as written by MarshalBinary, and a log of operations since then.
+type DurableBTree struct {
+	mu   sync.Mutex // Guards tree and wal.
+	dir  string
+	tree *BTree
+	wal  *WAL
+
+	checkpointMu sync.Mutex // Serializes checkpoints.
+}
+
+//=============================================================================
+//= Methods
+//=============================================================================
+
+// LogInsert records the insertion of an item.
+func (w *WAL) LogInsert(item Item) error {
+	return w.append(walInsert, item)
+}
+
+// LogDelete records the deletion of an item.
+func (w *WAL) LogDelete(item Item) error {
+	return w.append(walDelete, item)
+}
+
+// Size returns the size of the log in bytes.
+func (w *WAL) Size() int64 {
+	return w.size
+}
+
+// Sync commits all records to stable storage.
+func (w *WAL) Sync() error {
+	w.unsynced = 0
+	return w.file.Sync()
+}
+
+// Close syncs and closes the log.
+func (w *WAL) Close() error {
+	err := w.Sync()
+	if cerr := w.file.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// append writes a record to the end of the log, syncing it according to the
+// log's policy.
+func (w *WAL) append(op byte, item Item) error {
+	data, err := w.codec.MarshalItem(item)
+	if err != nil {
+		return err
+	}
+	record := make([]byte, walHeaderSize, walHeaderSize+1+len(data))
+	record = append(record, op)
+	record = append(record, data...)
+	payload := record[walHeaderSize:]
+	binary.BigEndian.PutUint32(record, uint32(len(payload)))
+	binary.BigEndian.PutUint32(record[4:], crc32.ChecksumIEEE(payload))
+
+	if _, err := w.file.Write(record); err != nil {
+		return err
+	}
+	w.size += int64(len(record))
+	w.unsynced++
+
+	switch w.opts.Sync {
+	case SyncAlways:
+		return w.Sync()
+	case SyncBatch:
+		if w.unsynced >= w.opts.SyncEvery {
+			return w.Sync()
+		}
+	}
+	return nil
+}
+
+// Insert logs and then inserts an item into the tree.
+func (d *DurableBTree) Insert(item Item) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if err := d.wal.LogInsert(item); err != nil {
+		return err
+	}
+	d.tree.Insert(item)
+	return nil
+}
+
+// Delete logs and then deletes an item from the tree.
+func (d *DurableBTree) Delete(item Item) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if err := d.wal.LogDelete(item); err != nil {
+		return err
+	}
+	d.tree.Delete(item)
+	return nil
+}
+
+// Tree returns the underlying BTree.
+//
+// NOTE: The tree must not be modified directly, as those changes would not be
+// logged, and must not be read while another goroutine modifies it.
+func (d *DurableBTree) Tree() *BTree {
+	return d.tree
+}
+
+// LogSize returns the size in bytes of the tree's log.
+func (d *DurableBTree) LogSize() int64 {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.wal.Size()
+}
+
+// Sync commits all logged operations to stable storage.
+func (d *DurableBTree) Sync() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.wal.Sync()
+}
+
+// Close syncs and closes the tree's log.
+func (d *DurableBTree) Close() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.wal.Close()
+}
+
+//=============================================================================
+//= Functions
+//=============================================================================
+
+// OpenWAL opens the log at path for appending, creating it if it does not
+// exist. Records are encoded with codec.
+//
+// If the log ends with torn or corrupted records, for example after a crash
+// mid-write, the log is truncated to the end of the last valid record. A
+// corrupted record followed by a valid one is reported as an error, and the
+// log is left unmodified.
+func OpenWAL(path string, codec ItemCodec, opts WALOptions) (*WAL, error) {
+	if codec == nil {
+		return nil, errors.New("WAL requires an item codec")
+	}
+	if opts.SyncEvery == 0 {
+		opts.SyncEvery = defaultSyncEvery
+	}
+
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+	size, err := scanWAL(file, nil)
+	if err == nil {
+		err = file.Truncate(size)
+	}
+	if err == nil {
+		_, err = file.Seek(size, io.SeekStart)
+	}
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	return &WAL{file: file, codec: codec, opts: opts, size: size}, nil
+}
+
+// OpenDurable opens the DurableBTree stored in dir, creating the directory if
+// it does not exist. The tree is recovered as described by Recover, and new
+// operations are appended to its log.
+func OpenDurable(dir string, order int, codec ItemCodec, opts WALOptions) (*DurableBTree, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	tree, err := Recover(dir, order, codec)
+	if err != nil {
+		return nil, err
+	}
+	wal, err := OpenWAL(filepath.Join(dir, walFile), codec, opts)
+	if err != nil {
+		return nil, err
+	}
+	return &DurableBTree{dir: dir, tree: tree, wal: wal}, nil
+}
+
+// Recover rebuilds the BTree stored in dir by a DurableBTree.
+//
+// The tree is loaded from the directory's snapshot, or created with the given
+// order if there is no snapshot, and the directory's logs are then replayed on
+// top of it. Replay of a log stops at its torn or corrupted final records, so
+// only operations which were completely written are recovered. A corrupted
+// record followed by a valid one is reported as an error, since the
+// operations after it were committed.
+func Recover(dir string, order int, codec ItemCodec) (*BTree, error) {
+	if codec == nil {
+		return nil, errors.New("Recover requires an item codec")
+	}
+	tree := New(order)
+	tree.SetCodec(codec)
+	data, err := os.ReadFile(filepath.Join(dir, snapshotFile))
+	if err == nil {
+		err = tree.UnmarshalBinary(data)
+	} else if os.IsNotExist(err) {
+		err = nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("loading snapshot: %v", err)
+	}
+
+	// A log rotated out by an unfinished checkpoint holds operations
+	// which precede those in the current log.
+	for _, name := range []string{walOldFile, walFile} {
+		if err := replayWAL(tree, filepath.Join(dir, name), codec); err != nil {
+			return nil, err
+		}
+	}
+	return tree, nil
+}
+
+// replayWAL applies the operations recorded in the log at path to tree.
+// A missing log is treated as empty.
+func replayWAL(tree *BTree, path string, codec ItemCodec) error {
+	file, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	_, err = scanWAL(file, func(op byte, data []byte) error {
+		item, err := codec.UnmarshalItem(data)
+		if err != nil {
+			return err
+		}
+		switch op {
+		case walInsert:
+			tree.Insert(item)
+		case walDelete:
+			tree.Delete(item)
+		default:
+			return fmt.Errorf("unknown WAL operation %d", op)
+		}
+		return nil
+	})
+	return err
+}
+
+// scanWAL reads the records of a log from its start, calling fn with each
+// valid record's operation and item data if fn is non-nil.
+//
+// It returns the size of the valid prefix of the log, stopping at the first
+// torn or corrupted record, provided that the rest of the log holds no valid
+// record. A crash can tear several unsynced records, or leave the log
+// extended with zeros, but a valid record after a bad one means the log is
+// corrupted, which is reported as an error rather than discarding the
+// records after it.
+func scanWAL(file *os.File, fn func(op byte, data []byte) error) (int64, error) {
+	info, err := file.Stat()
+	if err != nil {
+		return 0, err
+	}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return 0, err
+	}
+	r := bufio.NewReader(file)
+	var size int64
+	header := make([]byte, walHeaderSize)
+	for {
+		if _, err := io.ReadFull(r, header); err == io.EOF || err == io.ErrUnexpectedEOF {
+			return size, nil
+		} else if err != nil {
+			return 0, err
+		}
+		// A torn length may claim more data than the file holds.
+		length := int64(binary.BigEndian.Uint32(header))
+		if size+walHeaderSize+length > info.Size() {
+			return checkTornWAL(file, size, info.Size())
+		}
+		payload := make([]byte, length)
+		if _, err := io.ReadFull(r, payload); err == io.EOF || err == io.ErrUnexpectedEOF {
+			return checkTornWAL(file, size, info.Size())
+		} else if err != nil {
+			return 0, err
+		}
+		if len(payload) == 0 || crc32.ChecksumIEEE(payload) != binary.BigEndian.Uint32(header[4:]) {
+			return checkTornWAL(file, size, info.Size())
+		}
+		if fn != nil {
+			if err := fn(payload[0], payload[1:]); err != nil {
+				return 0, err
+			}
+		}
+		size += int64(walHeaderSize + len(payload))
+	}
+}
+
+// checkTornWAL checks the remainder of a log from offset, the start of a bad
+// record, to the end of the file at end. If it holds no valid record, it is a
+// torn tail, and offset is returned as the size of the valid log.
+func checkTornWAL(file *os.File, offset, end int64) (int64, error) {
+	rest := make([]byte, end-offset)
+	if _, err := file.ReadAt(rest, offset); err != nil {
+		return 0, err
+	}
+	for i := 1; i+walHeaderSize < len(rest); i++ {
+		length := int(binary.BigEndian.Uint32(rest[i:]))
+		start := i + walHeaderSize
+		if length == 0 || length > len(rest)-start {
+			continue
+		}
+		if crc32.ChecksumIEEE(rest[start:start+length]) == binary.BigEndian.Uint32(rest[i+4:]) {
+			return 0, fmt.Errorf("WAL record at offset %d is corrupted, but is followed by a valid record at offset %d", offset, offset+int64(i))
+		}
+	}
+	return offset, nil
+}
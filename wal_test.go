@@ -0,0 +1,159 @@
+package btree
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestDurableBTree(t *testing.T) {
+	policies := []WALOptions{
+		{Sync: SyncAlways},
+		{Sync: SyncBatch, SyncEvery: 7},
+		{Sync: SyncNever},
+	}
+
+	for _, opts := range policies {
+		dir := filepath.Join(t.TempDir(), "tree")
+		d, err := OpenDurable(dir, 5, testItemCodec{}, opts)
+		if err != nil {
+			t.Fatalf("OpenDurable should not have failed: %v", err)
+		}
+		massItems := uniqueInputsN(500)
+		for _, item := range massItems {
+			if err := d.Insert(item); err != nil {
+				t.Fatalf("Insert should not have failed: %v", err)
+			}
+		}
+		for _, item := range massItems[100:200] {
+			if err := d.Delete(item); err != nil {
+				t.Fatalf("Delete should not have failed: %v", err)
+			}
+		}
+		want := append(append([]Item(nil), massItems[:100]...), massItems[200:]...)
+		checkLoaded(t, d.Tree(), nil, want, false)
+		if err := d.Close(); err != nil {
+			t.Fatalf("Close should not have failed: %v", err)
+		}
+
+		// Should recover every logged operation
+		tree, err := Recover(dir, 5, testItemCodec{})
+		checkLoaded(t, tree, err, want, false)
+
+		// Should continue logging after reopening
+		d, err = OpenDurable(dir, 5, testItemCodec{}, opts)
+		if err != nil {
+			t.Fatalf("OpenDurable should not have failed: %v", err)
+		}
+		for _, item := range massItems[100:200] {
+			d.Insert(item)
+		}
+		d.Close()
+		tree, err = Recover(dir, 5, testItemCodec{})
+		checkLoaded(t, tree, err, massItems, false)
+	}
+}
+
+func TestRecoverTornWrites(t *testing.T) {
+	massItems := uniqueInputsN(50)
+	dir := t.TempDir()
+	d, err := OpenDurable(dir, 4, testItemCodec{}, WALOptions{Sync: SyncNever})
+	if err != nil {
+		t.Fatalf("OpenDurable should not have failed: %v", err)
+	}
+	for _, item := range massItems {
+		d.Insert(item)
+	}
+	d.Close()
+	walPath := filepath.Join(dir, walFile)
+	valid, _ := os.ReadFile(walPath)
+	recordSize := len(valid) / len(massItems)
+
+	cases := []struct {
+		name string
+		data []byte
+	}{
+		{name: "truncated payload", data: valid[:len(valid)-3]},
+		{name: "truncated header", data: append(valid[:len(valid)-recordSize], valid[len(valid)-recordSize:][:5]...)},
+		{name: "corrupted payload", data: corruptAt(valid, len(valid)-1)},
+		{name: "corrupted length", data: corruptAt(valid, len(valid)-recordSize)},
+		{name: "zero-filled tail", data: append(valid[:len(valid)-recordSize:len(valid)-recordSize], make([]byte, 25)...)},
+		{name: "zeroed unsynced records", data: append(valid[:len(valid)-recordSize:len(valid)-recordSize], make([]byte, 3*recordSize)...)},
+	}
+
+	for _, c := range cases {
+		os.WriteFile(walPath, c.data, 0644)
+
+		// Should recover every complete record
+		tree, err := Recover(dir, 4, testItemCodec{})
+		if err != nil {
+			t.Fatalf("%s: Recover should not have failed: %v", c.name, err)
+		}
+		checkLoaded(t, tree, nil, massItems[:len(massItems)-1], false)
+
+		// Should discard the torn record before appending
+		d, err := OpenDurable(dir, 4, testItemCodec{}, WALOptions{})
+		if err != nil {
+			t.Fatalf("%s: OpenDurable should not have failed: %v", c.name, err)
+		}
+		d.Insert(massItems[len(massItems)-1])
+		d.Close()
+		tree, err = Recover(dir, 4, testItemCodec{})
+		checkLoaded(t, tree, err, massItems, false)
+	}
+}
+
+func TestRecoverCorruptedLog(t *testing.T) {
+	massItems := uniqueInputsN(50)
+	dir := t.TempDir()
+	d, err := OpenDurable(dir, 4, testItemCodec{}, WALOptions{Sync: SyncNever})
+	if err != nil {
+		t.Fatalf("OpenDurable should not have failed: %v", err)
+	}
+	for _, item := range massItems {
+		d.Insert(item)
+	}
+	d.Close()
+	walPath := filepath.Join(dir, walFile)
+	valid, _ := os.ReadFile(walPath)
+	recordSize := len(valid) / len(massItems)
+	cases := []struct {
+		name string
+		data []byte
+	}{
+		{name: "corrupted payload", data: corruptAt(valid, 10*recordSize+walHeaderSize+1)},
+		{name: "corrupted length", data: corruptAt(valid, 10*recordSize)},
+	}
+
+	for _, c := range cases {
+		os.WriteFile(walPath, c.data, 0644)
+
+		// Should report corruption followed by committed records
+		if _, err := Recover(dir, 4, testItemCodec{}); err == nil {
+			t.Errorf("%s: Recover should have failed", c.name)
+		}
+		if _, err := OpenDurable(dir, 4, testItemCodec{}, WALOptions{}); err == nil {
+			t.Errorf("%s: OpenDurable should have failed", c.name)
+		}
+		if _, err := OpenWAL(walPath, testItemCodec{}, WALOptions{}); err == nil {
+			t.Errorf("%s: OpenWAL should have failed", c.name)
+		}
+
+		// Should not truncate the log
+		if data, _ := os.ReadFile(walPath); !bytes.Equal(data, c.data) {
+			t.Errorf("%s: Log should not have been modified", c.name)
+		}
+	}
+}
+
+//=============================================================================
+//= Helpers
+//=============================================================================
+
+// corruptAt returns a copy of data with the byte at index i flipped.
+func corruptAt(data []byte, i int) []byte {
+	corrupt := append([]byte(nil), data...)
+	corrupt[i] ^= 0xff
+	return corrupt
+}
@@ -0,0 +1,206 @@
+package btree
+
+import (
+	"sync"
+)
+
+//=============================================================================
+//= Variables and Constants
+//=============================================================================
+
+// Kinds of change reported by Events.
+const (
+	EventInsert EventKind = iota + 1
+	EventDelete
+)
+
+//=============================================================================
+//= Types
+//=============================================================================
+
+// An EventKind is the kind of change reported by an Event.
+type EventKind int
+
+// An Event reports a change to a BTree.
+type Event struct {
+	Kind EventKind
+	Item Item // Item inserted or deleted.
+}
+
+// observers holds the subscribers to a BTree's changes.
+type observers struct {
+	mu   sync.Mutex // Guards subs and next.
+	subs []*subscriber
+	next int // ID of the next subscriber.
+}
+
+// A subscriber receives the Events for changes to items in [lo, hi).
+type subscriber struct {
+	id     int
+	lo, hi Item // Bounds of the items of interest, or nil if unbounded.
+	notify func(Event)
+}
+
+//=============================================================================
+//= Methods
+//=============================================================================
+
+// OnInsert registers fn to be called with every item inserted into the tree,
+// by Insert or InsertBatch. It returns a function which cancels the
+// registration.
+//
+// Callbacks are called synchronously, after the change is made and in the
+// order the changes are made. They must not modify the tree.
+func (b *BTree) OnInsert(fn func(item Item)) (cancel func()) {
+	return b.subscribe(nil, nil, func(e Event) {
+		if e.Kind == EventInsert {
+			fn(e.Item)
+		}
+	})
+}
+
+// OnDelete registers fn to be called with every item deleted from the tree.
+// It returns a function which cancels the registration.
+//
+// Callbacks are called as described by OnInsert.
+func (b *BTree) OnDelete(fn func(item Item)) (cancel func()) {
+	return b.subscribe(nil, nil, func(e Event) {
+		if e.Kind == EventDelete {
+			fn(e.Item)
+		}
+	})
+}
+
+// Watch returns a channel, with a buffer of buf Events, which receives an
+// Event for every change to an item in the range [lo, hi). A nil bound
+// leaves that end of the range unbounded. It also returns a function which
+// stops the watch.
+//
+// Events are sent synchronously and in the order the changes are made, so a
+// change blocks until its Event is buffered or received. The channel is not
+// closed when the watch is stopped, but no further Events are sent on it, and
+// a change blocked on it is released.
+//
+// NOTE: Trees created by Bulkload, Merge and similar functions start without
+// subscribers, so no Events are sent for their initial items. To bulk load or
+// merge items into a watched tree, use Load or MergeFrom, which do send them.
+// The items replaced by UnmarshalBinary and UnmarshalJSON are not reported.
+func (b *BTree) Watch(lo, hi Item, buf int) (<-chan Event, func()) {
+	ch := make(chan Event, buf)
+	done := make(chan struct{})
+	cancel := b.subscribe(lo, hi, func(e Event) {
+		select {
+		case ch <- e:
+		case <-done:
+		}
+	})
+	var once sync.Once
+	return ch, func() {
+		once.Do(func() {
+			close(done)
+			cancel()
+		})
+	}
+}
+
+// Load replaces the items of the tree with items, which must be in strictly
+// ascending order, building it bottom-up as BulkloadChecked does.
+//
+// Unlike BulkloadChecked, the tree keeps its subscribers, which receive an
+// Event for every item removed from the tree and then for every item loaded.
+func (b *BTree) Load(items []Item, opts BulkloadOptions) error {
+	loaded, err := BulkloadChecked(b.order, items, opts)
+	if err != nil {
+		return err
+	}
+	var removed []Item
+	if b.observed() {
+		for iter := b.NewIterator(); iter.HasNext(); {
+			item, _ := iter.Next()
+			removed = append(removed, item)
+		}
+	}
+	b.root = loaded.root
+	for _, item := range removed {
+		b.notify(EventDelete, item)
+	}
+	for _, item := range items {
+		b.notify(EventInsert, item)
+	}
+	return nil
+}
+
+// MergeFrom merges the items of other into the tree, as Merge does.
+//
+// Unlike Merge, the tree keeps its subscribers, which receive an Event for
+// every item of other which was not already in the tree.
+func (b *BTree) MergeFrom(other *BTree) error {
+	merged, err := Merge(b, other)
+	if err != nil {
+		return err
+	}
+	var added []Item
+	if b.observed() {
+		for iter := other.NewIterator(); iter.HasNext(); {
+			item, _ := iter.Next()
+			if _, ok := b.Search(item); !ok {
+				added = append(added, item)
+			}
+		}
+	}
+	b.root = merged.root
+	for _, item := range added {
+		b.notify(EventInsert, item)
+	}
+	return nil
+}
+
+// subscribe registers fn to be called with the Events for changes to items
+// in [lo, hi), and returns a function which cancels the registration.
+func (b *BTree) subscribe(lo, hi Item, fn func(Event)) func() {
+	obs := b.observers
+	obs.mu.Lock()
+	defer obs.mu.Unlock()
+	id := obs.next
+	obs.next++
+	obs.subs = append(obs.subs, &subscriber{id: id, lo: lo, hi: hi, notify: fn})
+	return func() {
+		obs.mu.Lock()
+		defer obs.mu.Unlock()
+		for i, s := range obs.subs {
+			if s.id == id {
+				// Subscribers are copied rather than modified in place,
+				// as notify may be iterating over them.
+				obs.subs = append(obs.subs[:i:i], obs.subs[i+1:]...)
+				return
+			}
+		}
+	}
+}
+
+// observed determines if the tree has any subscribers.
+func (b *BTree) observed() bool {
+	if b.observers == nil {
+		return false
+	}
+	b.observers.mu.Lock()
+	defer b.observers.mu.Unlock()
+	return len(b.observers.subs) > 0
+}
+
+// notify sends an Event to the tree's subscribers.
+func (b *BTree) notify(kind EventKind, item Item) {
+	// Only a zero-value tree, which cannot have subscribers, has no
+	// observers.
+	if b.observers == nil {
+		return
+	}
+	b.observers.mu.Lock()
+	subs := b.observers.subs
+	b.observers.mu.Unlock()
+	for _, s := range subs {
+		if (s.lo == nil || !item.Less(s.lo)) && (s.hi == nil || item.Less(s.hi)) {
+			s.notify(Event{Kind: kind, Item: item})
+		}
+	}
+}
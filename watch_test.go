@@ -0,0 +1,157 @@
+package btree
+
+import (
+	"testing"
+)
+
+func TestOnInsertOnDelete(t *testing.T) {
+	tree := New(3)
+	var events []Event
+	cancelInsert := tree.OnInsert(func(item Item) { events = append(events, Event{Kind: EventInsert, Item: item}) })
+	cancelDelete := tree.OnDelete(func(item Item) { events = append(events, Event{Kind: EventDelete, Item: item}) })
+
+	tree.Insert(&testItem{key: 2})
+	tree.InsertBatch([]Item{&testItem{key: 3}, &testItem{key: 1}, &testItem{key: 2}})
+	tree.Delete(&testItem{key: 2})
+	// Ignored changes should not be reported
+	tree.Insert(&testItem{key: 1})
+	tree.Delete(&testItem{key: 5})
+	// Changes should not be reported once cancelled
+	cancelInsert()
+	cancelDelete()
+	cancelDelete()
+	tree.Insert(&testItem{key: 4})
+	tree.Delete(&testItem{key: 1})
+
+	want := []Event{
+		{Kind: EventInsert, Item: &testItem{key: 2}},
+		{Kind: EventInsert, Item: &testItem{key: 1}},
+		{Kind: EventInsert, Item: &testItem{key: 3}},
+		{Kind: EventDelete, Item: &testItem{key: 2}},
+	}
+	if len(events) != len(want) {
+		t.Fatalf("Callbacks should have received %d events. Got: %v", len(want), events)
+	}
+	for i, e := range events {
+		if e.Kind != want[i].Kind || e.Item.(*testItem).key != want[i].Item.(*testItem).key {
+			t.Errorf("Event %d should be %v. Got: %v", i, want[i], e)
+		}
+	}
+}
+
+func TestWatch(t *testing.T) {
+	cases := []struct {
+		lo, hi Item
+		want   []int
+	}{
+		// Should report every change without bounds
+		{lo: nil, hi: nil, want: []int{0, 5, 9, 10, 5}},
+		// Should only report changes within the bounds
+		{lo: &testItem{key: 5}, hi: &testItem{key: 10}, want: []int{5, 9, 5}},
+		{lo: &testItem{key: 6}, hi: nil, want: []int{9, 10}},
+		{lo: nil, hi: &testItem{key: 5}, want: []int{0}},
+	}
+
+	for _, c := range cases {
+		tree := New(4)
+		ch, stop := tree.Watch(c.lo, c.hi, 10)
+		for _, key := range []int{0, 5, 9, 10} {
+			tree.Insert(&testItem{key: key})
+		}
+		tree.Delete(&testItem{key: 5})
+		stop()
+		tree.Insert(&testItem{key: 7})
+
+		for i, key := range c.want {
+			e := <-ch
+			wantKind := EventInsert
+			if i == len(c.want)-1 && key == 5 {
+				wantKind = EventDelete
+			}
+			if e.Kind != wantKind || e.Item.(*testItem).key != key {
+				t.Errorf("Watch should have received event for key %d. Got: %v", key, e)
+			}
+		}
+		if len(ch) != 0 {
+			t.Errorf("Watch should not have received more events. Got: %d", len(ch))
+		}
+	}
+}
+
+func TestWatchStopUnblocks(t *testing.T) {
+	tree := New(3)
+	ch, stop := tree.Watch(nil, nil, 0)
+	done := make(chan struct{})
+	go func() {
+		tree.Insert(&testItem{key: 1})
+		tree.Insert(&testItem{key: 2})
+		close(done)
+	}()
+
+	// The first change should be received, and stopping the watch should
+	// release the second.
+	if e := <-ch; e.Item.(*testItem).key != 1 {
+		t.Errorf("Watch should have received the first change. Got: %v", e)
+	}
+	stop()
+	<-done
+}
+
+func TestWatchConcurrently(t *testing.T) {
+	// Should not race with changes made on another goroutine
+	tree := New(3)
+	done := make(chan struct{})
+	go func() {
+		for i := 0; i < 1000; i++ {
+			tree.Insert(&testItem{key: i})
+		}
+		close(done)
+	}()
+	for i := 0; i < 10; i++ {
+		_, stop := tree.Watch(nil, nil, 1000)
+		stop()
+	}
+	<-done
+}
+
+func TestLoadMergeFrom(t *testing.T) {
+	tree := New(4)
+	var events []Event
+	tree.OnInsert(func(item Item) { events = append(events, Event{Kind: EventInsert, Item: item}) })
+	tree.OnDelete(func(item Item) { events = append(events, Event{Kind: EventDelete, Item: item}) })
+	tree.Insert(&testItem{key: 0})
+
+	// Should report removed and loaded items
+	if err := tree.Load([]Item{&testItem{key: 1}, &testItem{key: 2}}, BulkloadOptions{}); err != nil {
+		t.Fatalf("Load should not have failed: %v", err)
+	}
+	// Should report only the items which were not already in the tree
+	other := Bulkload(4, []Item{&testItem{key: 2}, &testItem{key: 3}})
+	if err := tree.MergeFrom(other); err != nil {
+		t.Fatalf("MergeFrom should not have failed: %v", err)
+	}
+	// Should report nothing for failed loads
+	if err := tree.Load([]Item{&testItem{key: 2}, &testItem{key: 1}}, BulkloadOptions{}); err == nil {
+		t.Errorf("Load of unsorted items should have failed")
+	}
+	if err := tree.MergeFrom(New(3)); err == nil {
+		t.Errorf("MergeFrom of a tree of another order should have failed")
+	}
+
+	want := []Event{
+		{Kind: EventInsert, Item: &testItem{key: 0}},
+		{Kind: EventDelete, Item: &testItem{key: 0}},
+		{Kind: EventInsert, Item: &testItem{key: 1}},
+		{Kind: EventInsert, Item: &testItem{key: 2}},
+		{Kind: EventInsert, Item: &testItem{key: 3}},
+	}
+	if len(events) != len(want) {
+		t.Fatalf("Callbacks should have received %d events. Got: %v", len(want), events)
+	}
+	for i, e := range events {
+		if e.Kind != want[i].Kind || e.Item.(*testItem).key != want[i].Item.(*testItem).key {
+			t.Errorf("Event %d should be %v. Got: %v", i, want[i], e)
+		}
+	}
+	checkLoaded(t, tree, nil, []Item{&testItem{key: 1}, &testItem{key: 2}, &testItem{key: 3}}, false)
+}